@@ -6,12 +6,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"bodsch.me/probe-service/internal/config"
 	"bodsch.me/probe-service/internal/logging"
@@ -22,45 +27,111 @@ import (
 //
 //	go build -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
 //
-// They are intentionally exported as plain package-level strings so any
-// build tool (GoReleaser, Make, Bazel) can fill them without reflection.
-// The runtime VERSION env var (handled by config.Load) still wins for the
-// HTTP responses; these values exist primarily for the startup log line
-// and for embedding build provenance into the binary.
+// They are intentionally plain package-level strings so any build tool
+// (GoReleaser, Make, Bazel) can fill them without reflection. version is
+// the default for the VERSION env var, which still wins when set; commit
+// and date are reported by /version in place of the VCS information the
+// Go toolchain embeds. Empty means unknown.
 var (
 	version = "dev"
-	commit  = "none"
-	date    = "unknown"
+	commit  = ""
+	date    = ""
 )
 
 // main is the process entrypoint. It loads configuration, builds a logger
 // and server, wires signal-based cancellation, and forwards non-trivial
 // errors to the OS as a non-zero exit code.
 func main() {
-	cfg, err := config.Load()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run does the work of main with the command-line arguments args and
+// returns the exit code, so that deferred cleanup (closing the log file)
+// happens before the process exits. Exit code 2 means a usage or
+// configuration error.
+func run(args []string, stdout, stderr io.Writer) int {
+	started := time.Now()
+	fs := flag.NewFlagSet("probe-service", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	validate := fs.Bool("validate-config", false, "load and validate the configuration, print it as JSON and exit")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	cfg, err := config.Load(config.WithDefaultVersion(version))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
-		os.Exit(2)
+		fmt.Fprintf(stderr, "config error: %v\n", err)
+		return 2
+	}
+	cfg.BuildCommit, cfg.BuildDate = commit, date
+	if *validate || cfg.ValidateOnly {
+		return printConfig(stdout, stderr, cfg)
+	}
+
+	logOut := stdout
+	if cfg.LogFile != "" {
+		f, err := logging.OpenRotatingFile(cfg.LogFile, int64(cfg.LogMaxSizeMB)<<20, cfg.LogMaxBackups)
+		if err != nil {
+			fmt.Fprintf(stderr, "log file error: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		logOut = f
 	}
 
-	log := logging.New(cfg.LogLevel)
+	level := new(slog.LevelVar)
+	level.Set(cfg.LogLevel)
+	log := logging.New(logOut, level, cfg.LogFormat)
+	log = logging.WithDeployment(log, cfg.PodName, cfg.PodNamespace, cfg.NodeName)
 	log.Info("build info",
-		"version", version,
+		"version", cfg.Version,
 		"commit", commit,
 		"date", date,
 	)
 
-	srv, err := server.New(cfg, log)
+	srv, err := server.New(cfg, log,
+		server.WithStartTime(started),
+		// Services built on this one close their resources here.
+		server.WithShutdownHook(func(context.Context) error {
+			log.Info("cleanup done")
+			return nil
+		}),
+	)
 	if err != nil {
 		log.Error("server build failed", "err", err)
-		os.Exit(1)
+		return 1
+	}
+
+	if cfg.DisableKeepAlive {
+		srv.SetKeepAlivesEnabled(false)
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	reloadLogLevelOnHUP(ctx, log, level)
+	toggleReadyOnUSR(ctx, log, srv)
+	go srv.Heartbeat(ctx, cfg.HeartbeatInterval)
 
 	if err := srv.Run(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Error("server terminated", "err", err)
-		os.Exit(1)
+		return 1
+	}
+	return 0
+}
+
+// printConfig writes the effective configuration as indented JSON to w,
+// with secrets redacted as in /info, for --validate-config and
+// VALIDATE_ONLY. Nothing is bound or opened, so it is safe to run in CI.
+// Write errors are reported on stderr.
+func printConfig(w, stderr io.Writer, cfg config.Config) int {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(server.ConfigSnapshot(cfg)); err != nil {
+		fmt.Fprintf(stderr, "config output error: %v\n", err)
+		return 1
 	}
+	return 0
 }
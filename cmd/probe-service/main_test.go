@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"bodsch.me/probe-service/internal/config"
+)
+
+// TestPrintConfig verifies that the configuration is printed as valid
+// JSON with the admin token redacted.
+func TestPrintConfig(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cfg := config.Config{ServiceName: "probe-service-test", AdminToken: "s3cret"}
+	if code := printConfig(&out, &errOut, cfg); code != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr %q)", code, errOut.String())
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if got["admin_token"] != "[redacted]" || strings.Contains(out.String(), "s3cret") {
+		t.Errorf("admin_token = %v, want [redacted] and no secret in\n%s", got["admin_token"], out.String())
+	}
+}
+
+// TestRun_ValidateConfig verifies the exit codes of --validate-config: 0
+// with the configuration on stdout, 2 with the error on stderr.
+func TestRun_ValidateConfig(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	var out, errOut bytes.Buffer
+	if code := run([]string{"--validate-config"}, &out, &errOut); code != 0 {
+		t.Fatalf("valid config: exit code = %d, want 0 (stderr %q)", code, errOut.String())
+	}
+	if !json.Valid(out.Bytes()) || strings.Contains(out.String(), "s3cret") {
+		t.Errorf("valid config: output is not redacted JSON:\n%s", out.String())
+	}
+
+	t.Setenv("PORT", "nope")
+	out.Reset()
+	errOut.Reset()
+	if code := run([]string{"--validate-config"}, &out, &errOut); code != 2 {
+		t.Errorf("bad config: exit code = %d, want 2", code)
+	}
+	if out.Len() != 0 || !strings.Contains(errOut.String(), "PORT") {
+		t.Errorf("bad config: stdout %q, stderr %q; want the error on stderr only", out.String(), errOut.String())
+	}
+
+	if code := run([]string{"--no-such-flag"}, &out, &errOut); code != 2 {
+		t.Errorf("unknown flag: exit code = %d, want 2", code)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"bodsch.me/probe-service/internal/server"
+)
+
+// reloadLogLevelOnHUP is a no-op on platforms without SIGHUP.
+func reloadLogLevelOnHUP(ctx context.Context, log *slog.Logger, level *slog.LevelVar) {}
+
+// toggleReadyOnUSR is a no-op on platforms without SIGUSR1 and SIGUSR2.
+func toggleReadyOnUSR(ctx context.Context, log *slog.Logger, srv *server.Server) {}
@@ -0,0 +1,67 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"bodsch.me/probe-service/internal/config"
+	"bodsch.me/probe-service/internal/server"
+)
+
+// reloadLogLevelOnHUP subscribes to SIGHUP before it returns, so that a
+// SIGHUP arriving during startup no longer terminates the process. Until
+// ctx is done, every SIGHUP then re-reads the configuration (environment
+// and CONFIG_FILE) in the background and applies its LOG_LEVEL to level,
+// so verbosity can be changed without a restart. Other settings are not
+// reloaded. An invalid configuration leaves the level unchanged.
+func reloadLogLevelOnHUP(ctx context.Context, log *slog.Logger, level *slog.LevelVar) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			}
+			cfg, err := config.Load(config.WithDefaultVersion(version))
+			if err != nil {
+				log.Warn("SIGHUP: config reload failed, log level unchanged", "err", err)
+				continue
+			}
+			if old := level.Level(); old != cfg.LogLevel {
+				level.Set(cfg.LogLevel)
+				log.Warn("SIGHUP: log level changed", "from", old.String(), "to", cfg.LogLevel.String())
+			}
+		}
+	}()
+}
+
+// toggleReadyOnUSR subscribes to SIGUSR1 and SIGUSR2 before it returns,
+// so neither terminates the process during startup. Until ctx is done,
+// readiness is then forced down on SIGUSR1 and up on SIGUSR2 in the
+// background, as a keyboard-free alternative to the admin endpoints
+// (kill -USR1 <pid>).
+func toggleReadyOnUSR(ctx context.Context, log *slog.Logger, srv *server.Server) {
+	usr := make(chan os.Signal, 1)
+	signal.Notify(usr, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(usr)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-usr:
+				ready := sig == syscall.SIGUSR2
+				srv.SetReady(ready)
+				log.Warn("signal: readiness forced", "signal", sig.String(), "ready", ready)
+			}
+		}
+	}()
+}
@@ -0,0 +1,99 @@
+// Package checks provides dependency health checks that can gate the
+// readiness probe, together with a small TTL cache so that frequent probe
+// scrapes do not hammer the dependencies, and a Registry that runs a set
+// of named checks concurrently.
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Func is a single health check. It returns nil when the dependency is
+// healthy. Implementations must honour ctx cancellation.
+type Func func(ctx context.Context) error
+
+// Result is the outcome of one check execution.
+type Result struct {
+	// Err is nil on success.
+	Err error
+	// Latency is how long the check took.
+	Latency time.Duration
+	// CheckedAt is when the check finished.
+	CheckedAt time.Time
+}
+
+// OK reports whether the check succeeded.
+func (r Result) OK() bool { return r.Err == nil }
+
+// Cached runs a Func at most once per TTL and serves the last Result in
+// between. It is safe for concurrent use; concurrent callers that find
+// the cache stale wait for a single execution instead of each running
+// the check.
+type Cached struct {
+	fn      Func
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu   sync.Mutex
+	last Result
+	have bool
+}
+
+// NewCached wraps fn so that it runs with the given timeout and its
+// result is reused for ttl. A non-positive ttl disables caching.
+func NewCached(fn Func, ttl, timeout time.Duration) *Cached {
+	return &Cached{fn: fn, ttl: ttl, timeout: timeout}
+}
+
+// Result returns the cached result, running the check first if the cache
+// is empty or older than the TTL. The check runs detached from any
+// request context so that a client disconnect cannot poison the cache.
+func (c *Cached) Result() Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.have && time.Since(c.last.CheckedAt) < c.ttl {
+		return c.last
+	}
+
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := c.fn(ctx)
+	c.last = Result{Err: err, Latency: time.Since(start), CheckedAt: time.Now()}
+	c.have = true
+	return c.last
+}
+
+// HTTPGet returns a Func that issues GET url with client and succeeds on
+// any 2xx response. A nil client means http.DefaultClient.
+func HTTPGet(client *http.Client, url string) Func {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %d", res.StatusCode)
+		}
+		return nil
+	}
+}
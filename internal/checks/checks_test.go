@@ -0,0 +1,114 @@
+package checks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCached_ReusesResultWithinTTL verifies that the wrapped check runs
+// once per TTL window.
+func TestCached_ReusesResultWithinTTL(t *testing.T) {
+	var calls atomic.Int32
+	c := NewCached(func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}, 50*time.Millisecond, time.Second)
+
+	for i := 0; i < 5; i++ {
+		if !c.Result().OK() {
+			t.Fatal("Result().OK() = false, want true")
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("check ran %d times within TTL, want 1", n)
+	}
+
+	time.Sleep(70 * time.Millisecond)
+	c.Result()
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("check ran %d times after TTL, want 2", n)
+	}
+}
+
+// TestCached_Timeout ensures the check is cancelled after the timeout and
+// reported as failed.
+func TestCached_Timeout(t *testing.T) {
+	c := NewCached(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 0, 20*time.Millisecond)
+
+	res := c.Result()
+	if !errors.Is(res.Err, context.DeadlineExceeded) {
+		t.Fatalf("Err = %v, want DeadlineExceeded", res.Err)
+	}
+}
+
+// TestHTTPGet checks the 2xx success criterion.
+func TestHTTPGet(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer ts.Close()
+
+	check := HTTPGet(ts.Client(), ts.URL)
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("200: err = %v, want nil", err)
+	}
+	status.Store(http.StatusServiceUnavailable)
+	if err := check(context.Background()); err == nil {
+		t.Fatal("503: err = nil, want error")
+	}
+}
+
+// TestRegistry_Run verifies that checks run concurrently, that one
+// failure fails the aggregate, and that reports keep registration order.
+func TestRegistry_Run(t *testing.T) {
+	slow := func(err error) Func {
+		return func(ctx context.Context) error {
+			time.Sleep(50 * time.Millisecond)
+			return err
+		}
+	}
+	r := NewRegistry()
+	r.Register(Check{Name: "a", Cached: NewCached(slow(nil), 0, time.Second)})
+	r.Register(Check{Name: "b", Cached: NewCached(slow(errors.New("down")), 0, time.Second)})
+	r.Register(Check{Name: "c", Cached: NewCached(slow(nil), 0, time.Second)})
+
+	start := time.Now()
+	ok, reports := r.Run()
+	if took := time.Since(start); took > 120*time.Millisecond {
+		t.Errorf("Run took %v, want checks to run concurrently", took)
+	}
+	if ok {
+		t.Error("Run ok = true with a failing check")
+	}
+	if len(reports) != 3 || reports[0].Name != "a" || reports[1].OK() || !reports[2].OK() {
+		t.Errorf("reports = %+v", reports)
+	}
+}
+
+// TestTCPDial checks success against a listening socket and failure once
+// it is closed.
+func TestTCPDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if err := TCPDial(addr)(context.Background()); err != nil {
+		t.Fatalf("TCPDial(listening) = %v, want nil", err)
+	}
+	ln.Close()
+	if err := TCPDial(addr)(context.Background()); err == nil {
+		t.Fatal("TCPDial(closed) = nil, want error")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || dragonfly)
+
+package checks
+
+import "errors"
+
+// DiskFree is not supported on this platform and always fails.
+func DiskFree(path string) (uint64, error) {
+	return 0, errors.New("disk check not supported on this platform")
+}
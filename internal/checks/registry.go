@@ -0,0 +1,90 @@
+package checks
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Check is a named, cached check registered with a Registry.
+type Check struct {
+	// Name identifies the check in probe responses.
+	Name string
+	// Kind describes the check type, e.g. "tcp" or "http".
+	Kind string
+	// Target is the address or URL the check probes; informational only.
+	Target string
+	// Cached runs the check and caches its result.
+	Cached *Cached
+}
+
+// Report is the outcome of one registered check.
+type Report struct {
+	Check
+	Result
+}
+
+// Registry holds named checks and runs them together. It is safe for
+// concurrent use.
+type Registry struct {
+	mu     sync.Mutex
+	checks []Check
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry { return &Registry{} }
+
+// Register adds a check. Names should be unique; Run reports checks in
+// registration order.
+func (r *Registry) Register(c Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, c)
+}
+
+// Len returns the number of registered checks.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.checks)
+}
+
+// Run executes all checks concurrently (each bounded by its own timeout
+// and served from its cache while fresh) and reports whether all of them
+// passed, together with the individual reports in registration order.
+// An empty registry passes.
+func (r *Registry) Run() (ok bool, reports []Report) {
+	r.mu.Lock()
+	checks := append([]Check(nil), r.checks...)
+	r.mu.Unlock()
+
+	reports = make([]Report, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = Report{Check: c, Result: c.Cached.Result()}
+		}()
+	}
+	wg.Wait()
+
+	ok = true
+	for _, rep := range reports {
+		ok = ok && rep.OK()
+	}
+	return ok, reports
+}
+
+// TCPDial returns a Func that succeeds if a TCP connection to addr
+// (host:port) can be established. The connection is closed immediately.
+func TCPDial(addr string) Func {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
@@ -5,37 +5,389 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"bodsch.me/probe-service/pkg/flagx"
 )
 
+// ReadyCheck is one named readiness check configured via
+// READY_CHECK_TCP_<NAME> or READY_CHECK_HTTP_<NAME>.
+type ReadyCheck struct {
+	// Name is the lower-cased <NAME> part of the variable.
+	Name string
+	// Kind is "tcp" or "http".
+	Kind string
+	// Target is host:port for "tcp" and an http(s) URL for "http".
+	Target string
+}
+
+// ProbeBody is a fixed body that replaces a probe's default 503 response
+// (PROBE_UNHEALTHY_BODY, PROBE_NOTREADY_BODY).
+type ProbeBody struct {
+	// Content is sent unchanged. Empty keeps the default body.
+	Content string
+	// JSON is set when Content starts with "{" or "["; Load has then
+	// checked that it is valid JSON. It selects application/json over
+	// text/plain.
+	JSON bool
+}
+
+// LoadOption customises Load.
+type LoadOption func(*loadOptions)
+
+// loadOptions collects the values set by LoadOption functions.
+type loadOptions struct {
+	defaultVersion string
+}
+
+// WithDefaultVersion sets the Version used when VERSION is unset. main
+// passes the version injected with -ldflags "-X main.version=...", so the
+// precedence is VERSION, then ldflags, then "dev".
+func WithDefaultVersion(v string) LoadOption {
+	return func(o *loadOptions) { o.defaultVersion = v }
+}
+
 // Config holds all runtime configuration derived from environment variables.
 type Config struct {
 	// Port is the TCP port the HTTP server binds to.
 	Port int
-	// StartupDelay is applied to BOTH the liveness and readiness flags
-	// after process start and after every admin reset.
+	// AdminPort, when non-zero and different from Port, moves /admin/*,
+	// /metrics and pprof to a separate listener on this port.
+	AdminPort int
+	// BindAddr is the IP or host name the TCP listener binds to when
+	// ListenAddr is empty. Empty binds all interfaces.
+	BindAddr string
+	// AdminBindAddr is the IP or host name the separate admin listener
+	// binds to. Load defaults it to BindAddr.
+	AdminBindAddr string
+	// ListenNetwork is "tcp" or "unix". Empty means "tcp".
+	ListenNetwork string
+	// ListenAddr is the socket path for "unix", or an explicit host:port
+	// for "tcp". Empty means ":<Port>" for "tcp".
+	ListenAddr string
+	// ListenFD, when positive, is an inherited file descriptor of an
+	// already bound listening socket that the main listener uses instead
+	// of binding ListenAddr. See Load for how it is set.
+	ListenFD int
+	// ReusePort sets SO_REUSEPORT on the TCP listeners, so several
+	// processes can bind the same port. It has no effect on a ListenFD
+	// socket and is rejected for "unix".
+	ReusePort bool
+	// ListenRetryCount is how often binding a listener is retried while
+	// its address is in use (EADDRINUSE), e.g. by the old process during
+	// a rolling restart. Zero fails at once.
+	ListenRetryCount int
+	// ListenRetryDelay is the wait before the first retry; it doubles
+	// with every further attempt, up to 30s.
+	ListenRetryDelay time.Duration
+	// StartupDelay is the shared default for HealthStartupDelay,
+	// ReadyStartupDelay and StartupProbeDelay when those are not set
+	// explicitly.
 	StartupDelay time.Duration
+	// HealthStartupDelay is applied to the liveness flag after process
+	// start and after every admin reset.
+	HealthStartupDelay time.Duration
+	// ReadyStartupDelay is applied to the readiness flag after process
+	// start and after every admin reset.
+	ReadyStartupDelay time.Duration
+	// ReadyRamp replaces the hard flip of readiness at the end of its
+	// delay with a slow start: during the second half of the delay a
+	// growing share of requests already gets 200.
+	ReadyRamp bool
+	// StartupProbeDelay is applied once to the startup flag behind
+	// /startupz. Unlike the other two it has no TTL and is never reset.
+	StartupProbeDelay time.Duration
+	// StartupDelayJitter, if positive, randomizes each flag's delay within
+	// [delay, delay+StartupDelayJitter] on every arm, so that replicas
+	// restarted together do not flip at the same moment.
+	StartupDelayJitter time.Duration
+	// WarmupDuration simulates warmup work: readiness additionally waits
+	// for a sleep of this length, started when the server begins
+	// listening. Zero disables it.
+	WarmupDuration time.Duration
+	// HealthTTL and ReadyTTL, when positive, make the corresponding flag
+	// flip back to false that long after it became true and re-arm its
+	// startup delay, cycling indefinitely. Zero keeps the flag true.
+	HealthTTL time.Duration
+	ReadyTTL  time.Duration
+	// HealthScript, when non-empty, drives the liveness flag through a
+	// timed sequence of up and down phases instead of the startup delay
+	// and HealthTTL. Admin resets restart it from the first step.
+	HealthScript flagx.Script
+	// HealthFailAfterRequests, when positive, holds the liveness flag at
+	// false once the main listener has served that many requests,
+	// simulating resource exhaustion. Zero disables it.
+	HealthFailAfterRequests int64
+	// HealthGraceAfterUnready, when positive, holds the liveness flag at
+	// false once the readiness flag has been lost (true, then false) for
+	// that long. Zero keeps liveness independent of readiness.
+	HealthGraceAfterUnready time.Duration
+	// HealthFailureRate is the probability (0-1) that a liveness request
+	// answers 503 although the flag is true. Zero is deterministic.
+	HealthFailureRate float64
+	// HealthCheckCmd, when non-empty, is a shell command run every
+	// HealthCheckInterval (with HealthCheckTimeout); liveness fails while
+	// its last run exited non-zero.
+	HealthCheckCmd      string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	// MinFreeDiskBytes, when positive, makes liveness fail while the file
+	// system containing DiskCheckPath has less space available.
+	MinFreeDiskBytes int64
+	// DiskCheckPath is the path whose file system MinFreeDiskBytes is
+	// checked against.
+	DiskCheckPath string
+	// MaxHeapBytes, when positive, makes readiness fail while the heap
+	// (runtime.MemStats.HeapAlloc, sampled every second) is larger.
+	MaxHeapBytes int64
 	// ServiceName is reported in JSON responses (json: "service").
 	ServiceName string
 	// Version is reported in JSON responses and the X-Service-Version header.
 	Version string
+	// BuildCommit and BuildDate are the commit and build date injected
+	// with -ldflags. They are not read from the environment; main fills
+	// them in after Load. Empty means unknown.
+	BuildCommit string
+	BuildDate   string
+	// EnvPrefix is the ENV_PREFIX the configuration was read with (without
+	// the trailing "_"), or "".
+	EnvPrefix string
 	// ShutdownWait is the maximum time the server is given to drain in-flight
 	// requests during graceful shutdown.
 	ShutdownWait time.Duration
+	// ShutdownHookTimeout bounds each shutdown hook registered with
+	// server.WithShutdownHook.
+	ShutdownHookTimeout time.Duration
+	// PreStopDelay is how long the server keeps serving with readiness
+	// forced to false after a shutdown signal, before Shutdown is called.
+	// It gives load balancers time to stop routing traffic.
+	PreStopDelay time.Duration
+	// DrainCloseIdle turns HTTP keep-alive off as soon as shutdown
+	// begins: idle connections are closed and responses during the drain
+	// carry "Connection: close", so clients reconnect elsewhere promptly.
+	DrainCloseIdle bool
 	// ReadTimeout, WriteTimeout, IdleTimeout map to the corresponding fields
 	// on http.Server.
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// DisableKeepAlive turns HTTP keep-alive off: every response carries
+	// "Connection: close" and clients must reconnect for each request.
+	DisableKeepAlive bool
+	// MaxConnections caps the simultaneously open connections on the main
+	// listener; further connections wait until one closes. Zero disables
+	// the limit.
+	MaxConnections int
 	// MaxBodyBytes caps the request body size. Non-positive disables the cap.
 	MaxBodyBytes int64
+	// MaxHeaderBytes caps the size of the request line and headers
+	// (http.Server.MaxHeaderBytes). Larger requests get 431.
+	MaxHeaderBytes int
 	// LogLevel is the minimum slog level emitted by the logger.
 	LogLevel slog.Level
+	// LogFormat is "json" or "text".
+	LogFormat string
+	// ProbeResponseFormat is "json" (the default envelope) or "text",
+	// which makes the probe endpoints answer with their bare status label
+	// as text/plain.
+	ProbeResponseFormat string
+	// JSONCase is "snake" (the default) or "camel", which rewrites the
+	// keys of all JSON responses to camelCase.
+	JSONCase string
+	// TimeFormat is how timestamps in JSON responses are rendered:
+	// "rfc3339" (the default), "rfc3339nano" or "unixmillis".
+	TimeFormat string
+	// ProbeExtra holds additional fields, parsed from the JSON object in
+	// PROBE_EXTRA_JSON, that are merged into every JSON probe response.
+	// Keys that clash with the probe's own fields are ignored.
+	ProbeExtra map[string]any
+	// ProbeUnhealthyBody and ProbeNotReadyBody, when set, replace the
+	// body of 503 liveness and readiness responses. Status code and
+	// Retry-After are unchanged.
+	ProbeUnhealthyBody ProbeBody
+	ProbeNotReadyBody  ProbeBody
+	// ProbePayloadBytes, if positive, pads every JSON probe response with
+	// a "padding" field of that many base64 characters.
+	ProbePayloadBytes int
+	// LogSampleRate is the fraction (0-1) of successful probe requests
+	// that are written to the access log. Errors are always logged.
+	LogSampleRate float64
+	// LogConnState logs the lifecycle of every connection (new, active,
+	// idle, closed) to debug keep-alive and connection reuse.
+	LogConnState bool
+	// DebugDumpRequests logs every request in wire format, with up to
+	// MaxBodyBytes of its body, at debug level.
+	DebugDumpRequests bool
+	// LogFile, when set, sends the log to this file instead of stdout.
+	LogFile string
+	// LogMaxSizeMB is the size at which LogFile is rotated.
+	LogMaxSizeMB int
+	// LogMaxBackups is how many rotated files (LogFile.1, .2, ...) are kept.
+	LogMaxBackups int
+	// PodName, PodNamespace and NodeName identify the Kubernetes pod
+	// (usually set through the downward API). Non-empty values are added
+	// to every log line as the "deployment" group.
+	PodName      string
+	PodNamespace string
+	NodeName     string
+	// HeartbeatInterval is how often a heartbeat line with uptime,
+	// goroutine count and probe states is logged. Zero disables it.
+	HeartbeatInterval time.Duration
+	// TLSCertFile and TLSKeyFile are paths to a PEM certificate and key.
+	// When both are set the server speaks HTTPS; Load rejects setting
+	// only one of them.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCA is a PEM file of CA certificates. When set, the admin
+	// listener requires a client certificate signed by one of them
+	// (mutual TLS); the main listener does not. Load requires TLS and a
+	// separate ADMIN_PORT with it.
+	TLSClientCA string
+	// ReadyDependencyURL, when non-empty, must answer a GET with 2xx for
+	// the readiness probe to report ready.
+	ReadyDependencyURL string
+	// ReadyDependencyTimeout bounds a single dependency check. It also
+	// applies to every entry in ReadyChecks.
+	ReadyDependencyTimeout time.Duration
+	// ReadyDependencyTTL is how long a dependency check result is reused.
+	// It also applies to every entry in ReadyChecks.
+	ReadyDependencyTTL time.Duration
+	// ReadyChecks are additional named checks that must all pass for the
+	// readiness probe to report ready. Sorted by name.
+	ReadyChecks []ReadyCheck
+	// ReadyFile, when non-empty, is a path that must exist for the
+	// readiness probe to report ready, e.g. a touch-file written by an
+	// init process. With ReadyFileNonEmpty it must also be non-empty.
+	ReadyFile         string
+	ReadyFileNonEmpty bool
+	// ReadyAfterHealthChecks, when positive, keeps readiness down until
+	// the liveness probe has answered 200 that many times.
+	ReadyAfterHealthChecks int
+	// ResponseDelay is an artificial latency added before every response.
+	ResponseDelay time.Duration
+	// ResponseDelayMax caps the per-request ?delay= override, which only
+	// applies to non-probe, non-admin routes. Zero (the default) disables
+	// the override.
+	ResponseDelayMax time.Duration
+	// HandlerTimeout, when positive, answers 504 for non-probe requests
+	// (including any injected delay) that take longer. Zero disables it.
+	HandlerTimeout time.Duration
+	// RateLimitRPS, when positive, limits requests to that many per second
+	// (probe endpoints are exempt). RateLimitBurst is the bucket size.
+	RateLimitRPS   float64
+	RateLimitBurst int
+	// RateLimitPerIP applies the limit per client IP instead of globally.
+	RateLimitPerIP bool
+	// EnableSecurityHeaders adds nosniff/DENY headers to every response,
+	// and Strict-Transport-Security on TLS connections.
+	EnableSecurityHeaders bool
+	// HSTSMaxAge is the Strict-Transport-Security max-age. Zero omits HSTS.
+	HSTSMaxAge time.Duration
+	// EnableRemoteShutdown registers POST /admin/shutdown. Load requires
+	// AdminToken with it, so the route is never unauthenticated.
+	EnableRemoteShutdown bool
+	// AdminDisabled (ADMIN_ENABLED=false) leaves all /admin/* routes
+	// unregistered so they answer 404; /metrics is unaffected. It is
+	// stored negated so that the zero Config keeps the admin API.
+	AdminDisabled bool
+	// AdminResetDisabled (ADMIN_RESET_ENABLED=false) leaves the
+	// state-changing /admin/* routes (reset, up, down, maintenance)
+	// unregistered; /admin/status and /admin/stats remain.
+	AdminResetDisabled bool
+	// ResetMinInterval, if positive, is the minimum time between two
+	// accepted admin resets; earlier ones get 429.
+	ResetMinInterval time.Duration
+	// EnableTracing turns on per-request server spans exported via OTLP.
+	EnableTracing bool
+	// OTLPEndpoint is the OTLP/HTTP base URL spans are sent to.
+	OTLPEndpoint string
+	// TrustedProxies lists the networks whose X-Forwarded-For headers are
+	// trusted when deriving the client IP. Empty means RemoteAddr is used.
+	TrustedProxies []netip.Prefix
+	// EnableCompression turns on gzip/deflate response compression.
+	EnableCompression bool
+	// EnableH2C lets plain-text listeners speak HTTP/2 with prior
+	// knowledge (h2c) in addition to HTTP/1.1.
+	EnableH2C bool
+	// EnableProxyProtocol requires a PROXY protocol (v1 or v2) header on
+	// every connection to the main listener and takes the client address
+	// from it.
+	EnableProxyProtocol bool
+	// StaticDir, when set, is a directory served under /static/, e.g. for
+	// a status page. Load checks that it exists.
+	StaticDir string
+	// StaticMaxAge is the Cache-Control max-age of StaticDir files. Zero
+	// sends "no-cache".
+	StaticMaxAge time.Duration
+	// EnablePprof mounts net/http/pprof under /debug/pprof/. It exposes
+	// sensitive process internals and is off by default.
+	EnablePprof bool
+	// EnableTLSReflect registers GET /reflect/tls, which reports the
+	// negotiated TLS parameters of the request's connection.
+	EnableTLSReflect bool
+	// CORSAllowedOrigins lists origins allowed to read responses
+	// cross-origin; a single "*" allows any. Empty disables CORS headers.
+	CORSAllowedOrigins []string
+	// CustomHeaders are static headers added to every response.
+	CustomHeaders http.Header
+	// CustomHeadersSkipped lists CUSTOM_HEADERS entries that were ignored
+	// because of an invalid name or value, for the caller to warn about.
+	CustomHeadersSkipped []string
+	// RequestIDHeader is the header from which inbound request IDs are
+	// reused and on which the request ID is echoed.
+	RequestIDHeader string
+	// RequestIDMaxLen is the maximum length of an inbound request ID that
+	// is reused; longer or non-printable IDs are replaced.
+	RequestIDMaxLen int
+	// AdminToken, when non-empty, is required as "Authorization: Bearer
+	// <token>" on all /admin/* endpoints. It must never be logged.
+	AdminToken string
+	// ValidateOnly makes the binary print the effective configuration
+	// and exit instead of serving (VALIDATE_ONLY, like --validate-config).
+	ValidateOnly bool
+}
+
+// Listen returns the network and address to pass to net.Listen,
+// applying the defaults documented on ListenNetwork and ListenAddr.
+func (c Config) Listen() (network, addr string) {
+	network = c.ListenNetwork
+	if network == "" {
+		network = "tcp"
+	}
+	addr = c.ListenAddr
+	if addr == "" && network == "tcp" {
+		addr = net.JoinHostPort(c.BindAddr, strconv.Itoa(c.Port))
+	}
+	return network, addr
+}
+
+// AdminListenAddr returns the TCP address of the separate admin listener
+// (see SplitAdmin).
+func (c Config) AdminListenAddr() string {
+	return net.JoinHostPort(c.AdminBindAddr, strconv.Itoa(c.AdminPort))
+}
+
+// SplitAdmin reports whether admin routes are served on their own port.
+func (c Config) SplitAdmin() bool {
+	return c.AdminPort != 0 && c.AdminPort != c.Port
+}
+
+// TLSEnabled reports whether both TLS certificate and key are configured.
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
 }
 
 // Load reads environment variables and returns a validated Config.
@@ -44,71 +396,810 @@ type Config struct {
 // Recognised variables and defaults:
 //
 //	PORT             (int 1-65535)         default 8080
+//	ADMIN_PORT       (int 1-65535)         default unset (admin on PORT)
+//	BIND_ADDR        (IP | host name)      default "" (all interfaces)
+//	ADMIN_BIND_ADDR  (IP | host name)      default BIND_ADDR
+//	LISTEN_NETWORK   (tcp|unix)            default tcp
+//	LISTEN_ADDR      (host:port | path)    default ":PORT" (required for unix)
+//	LISTEN_FD        (int >= 3)            default systemd socket or unset
+//	REUSEPORT        (bool)                default false
+//	LISTEN_RETRY_COUNT (int 0-1000)        default 0 (fail at once)
+//	LISTEN_RETRY_DELAY (time.Duration)     default 1s (doubling, capped at 30s)
 //	STARTUP_DELAY    (time.Duration)       default 30s
+//	HEALTH_STARTUP_DELAY (time.Duration)   default STARTUP_DELAY
+//	READY_STARTUP_DELAY  (time.Duration)   default STARTUP_DELAY
+//	READY_RAMP       (bool)                default false
+//	STARTUP_PROBE_DELAY  (time.Duration)   default STARTUP_DELAY
+//	STARTUP_DELAY_JITTER (time.Duration)   default 0 (exact delays)
+//	WARMUP_DURATION  (time.Duration)       default 0 (no warmup)
+//	HEALTH_TTL       (time.Duration)       default 0 (no cycling)
+//	HEALTH_SCRIPT    ("ok:10s,fail:5s,loop") default "" (startup delay)
+//	READY_TTL        (time.Duration)       default 0 (no cycling)
+//	HEALTH_FAIL_AFTER_REQUESTS (int64 >= 0) default 0 (disabled)
+//	HEALTH_GRACE_AFTER_UNREADY (time.Duration) default 0 (disabled)
+//	HEALTH_FAILURE_RATE (float 0-1)        default 0 (never fail randomly)
+//	HEALTH_CHECK_CMD (shell command)       default "" (disabled)
+//	HEALTH_CHECK_INTERVAL (time.Duration > 0) default 10s
+//	HEALTH_CHECK_TIMEOUT (time.Duration)   default 5s
+//	MIN_FREE_DISK_BYTES (int64 >= 0)       default 0 (no disk check)
+//	DISK_CHECK_PATH  (path)                default "/"
+//	MAX_HEAP_BYTES   (int64 >= 0)          default 0 (no heap check)
 //	SERVICE_NAME     (string)              default "probe-service"
-//	VERSION          (string)              default "1.0.0"
+//	VERSION          (string)              default "dev" (see WithDefaultVersion)
 //	SHUTDOWN_WAIT    (time.Duration)       default 10s
+//	SHUTDOWN_HOOK_TIMEOUT (time.Duration > 0) default 5s
+//	PRESTOP_DELAY    (time.Duration)       default 0
+//	DRAIN_CLOSE_IDLE (bool)                default false
 //	READ_TIMEOUT     (time.Duration)       default 15s
 //	WRITE_TIMEOUT    (time.Duration)       default 15s
 //	IDLE_TIMEOUT     (time.Duration)       default 60s
+//	DISABLE_KEEPALIVE (bool)               default false
+//	MAX_CONNECTIONS  (int >= 0)            default 0 (unlimited)
 //	MAX_BODY_BYTES   (int64 > 0)           default 1 MiB
+//	MAX_HEADER_BYTES (int > 0)             default 1 MiB
 //	LOG_LEVEL        (debug|info|warn|error) default info
-func Load() (Config, error) {
-	port, err := envInt("PORT", 8080, 1, 65535)
+//	LOG_FORMAT       (json|text)           default json
+//	PROBE_RESPONSE_FORMAT (json|text)      default json
+//	JSON_CASE        (snake | camel)       default "snake"
+//	TIME_FORMAT      (rfc3339|rfc3339nano|unixmillis) default rfc3339
+//	PROBE_EXTRA_JSON (JSON object)         default "" (no extra fields)
+//	PROBE_UNHEALTHY_BODY (JSON or text)    default "" (standard body)
+//	PROBE_NOTREADY_BODY (JSON or text)     default "" (standard body)
+//	PROBE_PAYLOAD_BYTES (int, <= 1 MiB)    default 0 (no padding)
+//	LOG_SAMPLE_RATE  (float 0-1)           default 1 (log every request)
+//	LOG_CONN_STATE   (bool)                default false
+//	DEBUG_DUMP_REQUESTS (bool)             default false
+//	LOG_FILE         (path)                default "" (stdout)
+//	LOG_MAX_SIZE_MB  (int 1-1048576)       default 100
+//	LOG_MAX_BACKUPS  (int 0-1000)          default 3
+//	POD_NAME         (string)              default "" (omitted from logs)
+//	POD_NAMESPACE    (string)              default "" (omitted from logs)
+//	NODE_NAME        (string)              default "" (omitted from logs)
+//	HEARTBEAT_INTERVAL (time.Duration)     default 0 (disabled)
+//	TLS_CERT_FILE    (path)                default "" (TLS disabled)
+//	TLS_KEY_FILE     (path)                default "" (TLS disabled)
+//	TLS_CLIENT_CA    (path)                default "" (no client certificates)
+//	ADMIN_TOKEN      (string)              default "" (admin unauthenticated)
+//	READY_DEPENDENCY_URL (http(s) URL)     default "" (disabled)
+//	READY_DEPENDENCY_TIMEOUT (time.Duration) default 2s
+//	READY_DEPENDENCY_TTL (time.Duration)   default 5s
+//	READY_CHECK_TCP_<NAME>  (host:port)    named TCP-dial readiness check
+//	READY_CHECK_HTTP_<NAME> (http(s) URL)  named HTTP-GET readiness check
+//	READY_FILE       (path)                default "" (disabled)
+//	READY_FILE_NONEMPTY (bool)             default false
+//	READY_AFTER_HEALTH_CHECKS (int >= 0)   default 0 (disabled)
+//	RESPONSE_DELAY   (time.Duration)       default 0
+//	REQUEST_ID_HEADER (string)             default "X-Request-Id"
+//	REQUEST_ID_MAX_LEN (int)               default 128
+//	ENABLE_COMPRESSION (bool)              default false
+//	ENABLE_H2C       (bool)                default false
+//	ENABLE_PROXY_PROTOCOL (bool)           default false
+//	ENABLE_PPROF     (bool)                default false
+//	ENABLE_TLS_REFLECT (bool)              default false
+//	STATIC_DIR       (directory)           default "" (disabled)
+//	STATIC_MAX_AGE   (time.Duration)       default 1h
+//	CORS_ALLOWED_ORIGINS (comma list | *)  default "" (CORS disabled)
+//	CUSTOM_HEADERS   ("Key:Value;..." list) default "" (invalid entries skipped)
+//	RESPONSE_DELAY_MAX (time.Duration)     default 0 (?delay= disabled)
+//	HANDLER_TIMEOUT  (time.Duration)       default 0 (disabled)
+//	RATE_LIMIT_RPS   (float >= 0)          default 0 (disabled)
+//	RATE_LIMIT_BURST (int >= 1)            default ceil(RATE_LIMIT_RPS)
+//	RATE_LIMIT_PER_IP (bool)               default false
+//	TRUSTED_PROXIES  (comma list of CIDR/IP) default "" (XFF ignored)
+//	ENABLE_SECURITY_HEADERS (bool)         default false
+//	HSTS_MAX_AGE     (time.Duration)       default 8760h (1 year; 0 omits HSTS)
+//	ENABLE_TRACING   (bool)                default false
+//	ENABLE_REMOTE_SHUTDOWN (bool)          default false (requires ADMIN_TOKEN)
+//	ADMIN_ENABLED    (bool)                default true
+//	ADMIN_RESET_ENABLED (bool)             default true
+//	RESET_MIN_INTERVAL (time.Duration)     default 0 (unlimited resets)
+//	OTEL_EXPORTER_OTLP_ENDPOINT (http(s) URL) default "http://localhost:4318"
+//	VALIDATE_ONLY    (bool)                default false
+//
+// If CONFIG_FILE names a JSON or YAML file, its keys (the variable names
+// above, case-insensitive) supply values for variables that are not set
+// in the environment; the environment always wins. Unknown keys in the
+// file are an error.
+//
+// ENV_PREFIX (itself never prefixed) makes every variable above,
+// including CONFIG_FILE, readable as <ENV_PREFIX>_<NAME>, which takes
+// precedence over the plain name; see source for the full order.
+func Load(opts ...LoadOption) (Config, error) {
+	o := loadOptions{defaultVersion: "dev"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	envPrefix, err := parseEnvPrefix(os.Getenv("ENV_PREFIX"))
+	if err != nil {
+		return Config{}, err
+	}
+	src, err := newSource(strings.TrimSpace(lookupEnv(envPrefix, "CONFIG_FILE")), envPrefix)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := load(src, o)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.EnvPrefix = strings.TrimSuffix(envPrefix, "_")
+	if err := src.checkUnused(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// load reads every variable from src and validates it.
+func load(src *source, o loadOptions) (Config, error) {
+	port, err := src.envInt("PORT", 8080, 1, 65535)
+	if err != nil {
+		return Config{}, err
+	}
+	adminPort, err := src.envInt("ADMIN_PORT", 0, 1, 65535)
+	if err != nil {
+		return Config{}, err
+	}
+	bindAddr, err := src.envHost("BIND_ADDR", "")
+	if err != nil {
+		return Config{}, err
+	}
+	adminBindAddr, err := src.envHost("ADMIN_BIND_ADDR", bindAddr)
+	if err != nil {
+		return Config{}, err
+	}
+	listenNetwork := strings.ToLower(src.envStr("LISTEN_NETWORK", "tcp"))
+	listenAddr := src.envStr("LISTEN_ADDR", "")
+	switch listenNetwork {
+	case "tcp":
+		if listenAddr != "" {
+			if _, _, err := net.SplitHostPort(listenAddr); err != nil {
+				return Config{}, fmt.Errorf("invalid LISTEN_ADDR=%q (expected host:port for tcp)", listenAddr)
+			}
+		}
+	case "unix":
+		if listenAddr == "" {
+			return Config{}, errors.New("invalid LISTEN_ADDR=\"\" (socket path required for LISTEN_NETWORK=unix)")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid LISTEN_NETWORK=%q (expected tcp or unix)", listenNetwork)
+	}
+	listenFD, err := src.envInt("LISTEN_FD", systemdListenFD(), 3, math.MaxInt32)
+	if err != nil {
+		return Config{}, err
+	}
+	reusePort, err := src.envBool("REUSEPORT", false)
+	if err != nil {
+		return Config{}, err
+	}
+	if reusePort && listenNetwork == "unix" {
+		return Config{}, errors.New("invalid REUSEPORT=true (only supported for LISTEN_NETWORK=tcp)")
+	}
+	listenRetryCount, err := src.envInt("LISTEN_RETRY_COUNT", 0, 0, 1000)
+	if err != nil {
+		return Config{}, err
+	}
+	listenRetryDelay, err := src.envDuration("LISTEN_RETRY_DELAY", time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	if listenRetryDelay == 0 {
+		return Config{}, fmt.Errorf("invalid LISTEN_RETRY_DELAY=%q (expected positive duration)", src.get("LISTEN_RETRY_DELAY"))
+	}
+	startupDelay, err := src.envDuration("STARTUP_DELAY", 30*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	healthDelay, err := src.envDuration("HEALTH_STARTUP_DELAY", startupDelay, false)
+	if err != nil {
+		return Config{}, err
+	}
+	readyDelay, err := src.envDuration("READY_STARTUP_DELAY", startupDelay, false)
+	if err != nil {
+		return Config{}, err
+	}
+	readyRamp, err := src.envBool("READY_RAMP", false)
+	if err != nil {
+		return Config{}, err
+	}
+	startupProbeDelay, err := src.envDuration("STARTUP_PROBE_DELAY", startupDelay, false)
+	if err != nil {
+		return Config{}, err
+	}
+	delayJitter, err := src.envDuration("STARTUP_DELAY_JITTER", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	warmupDuration, err := src.envDuration("WARMUP_DURATION", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	healthTTL, err := src.envDuration("HEALTH_TTL", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	rawScript := src.envStr("HEALTH_SCRIPT", "")
+	healthScript, err := flagx.ParseScript(rawScript)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid HEALTH_SCRIPT=%q (%v)", rawScript, err)
+	}
+	readyTTL, err := src.envDuration("READY_TTL", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	failAfter, err := src.envInt64("HEALTH_FAIL_AFTER_REQUESTS", 0, 0)
+	if err != nil {
+		return Config{}, err
+	}
+	healthGrace, err := src.envDuration("HEALTH_GRACE_AFTER_UNREADY", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	failureRate, err := src.envFloat("HEALTH_FAILURE_RATE", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	if failureRate > 1 {
+		return Config{}, fmt.Errorf("invalid HEALTH_FAILURE_RATE=%q (expected number in [0,1])", src.get("HEALTH_FAILURE_RATE"))
+	}
+	checkInterval, err := src.envDuration("HEALTH_CHECK_INTERVAL", 10*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	if checkInterval == 0 {
+		return Config{}, fmt.Errorf("invalid HEALTH_CHECK_INTERVAL=%q (expected positive duration)", src.get("HEALTH_CHECK_INTERVAL"))
+	}
+	checkTimeout, err := src.envDuration("HEALTH_CHECK_TIMEOUT", 5*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	minFreeDisk, err := src.envInt64("MIN_FREE_DISK_BYTES", 0, 0)
+	if err != nil {
+		return Config{}, err
+	}
+	diskCheckPath := src.envStr("DISK_CHECK_PATH", "/")
+	maxHeap, err := src.envInt64("MAX_HEAP_BYTES", 0, 0)
+	if err != nil {
+		return Config{}, err
+	}
+	shutdownWait, err := src.envDuration("SHUTDOWN_WAIT", 10*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	hookTimeout, err := src.envDuration("SHUTDOWN_HOOK_TIMEOUT", 5*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	if hookTimeout == 0 {
+		return Config{}, fmt.Errorf("invalid SHUTDOWN_HOOK_TIMEOUT=%q (expected positive duration)", src.get("SHUTDOWN_HOOK_TIMEOUT"))
+	}
+	preStopDelay, err := src.envDuration("PRESTOP_DELAY", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	drainCloseIdle, err := src.envBool("DRAIN_CLOSE_IDLE", false)
+	if err != nil {
+		return Config{}, err
+	}
+	readTimeout, err := src.envDuration("READ_TIMEOUT", 15*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	writeTimeout, err := src.envDuration("WRITE_TIMEOUT", 15*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	idleTimeout, err := src.envDuration("IDLE_TIMEOUT", 60*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	disableKeepAlive, err := src.envBool("DISABLE_KEEPALIVE", false)
+	if err != nil {
+		return Config{}, err
+	}
+	maxConns, err := src.envInt("MAX_CONNECTIONS", 0, 0, 1_000_000)
+	if err != nil {
+		return Config{}, err
+	}
+	maxBody, err := src.envInt64("MAX_BODY_BYTES", 1<<20, 1)
+	if err != nil {
+		return Config{}, err
+	}
+	maxHeader, err := src.envInt("MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes, 1, math.MaxInt32)
+	if err != nil {
+		return Config{}, err
+	}
+	depURL := src.envStr("READY_DEPENDENCY_URL", "")
+	if depURL != "" {
+		u, err := url.Parse(depURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("invalid READY_DEPENDENCY_URL=%q (expected http(s)://host/…)", depURL)
+		}
+	}
+	depTimeout, err := src.envDuration("READY_DEPENDENCY_TIMEOUT", 2*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	depTTL, err := src.envDuration("READY_DEPENDENCY_TTL", 5*time.Second, false)
+	if err != nil {
+		return Config{}, err
+	}
+	readyChecks, err := src.readyChecks()
+	if err != nil {
+		return Config{}, err
+	}
+	readyFileNonEmpty, err := src.envBool("READY_FILE_NONEMPTY", false)
+	if err != nil {
+		return Config{}, err
+	}
+	readyAfterHealthChecks, err := src.envInt("READY_AFTER_HEALTH_CHECKS", 0, 0, math.MaxInt32)
+	if err != nil {
+		return Config{}, err
+	}
+	responseDelay, err := src.envDuration("RESPONSE_DELAY", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	responseDelayMax, err := src.envDuration("RESPONSE_DELAY_MAX", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	handlerTimeout, err := src.envDuration("HANDLER_TIMEOUT", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	logFormat := strings.ToLower(src.envStr("LOG_FORMAT", "json"))
+	if logFormat != "json" && logFormat != "text" {
+		return Config{}, fmt.Errorf("invalid LOG_FORMAT=%q (expected json or text)", logFormat)
+	}
+	probeFormat := strings.ToLower(src.envStr("PROBE_RESPONSE_FORMAT", "json"))
+	if probeFormat != "json" && probeFormat != "text" {
+		return Config{}, fmt.Errorf("invalid PROBE_RESPONSE_FORMAT=%q (expected json or text)", probeFormat)
+	}
+	jsonCase := strings.ToLower(src.envStr("JSON_CASE", "snake"))
+	if jsonCase != "snake" && jsonCase != "camel" {
+		return Config{}, fmt.Errorf("invalid JSON_CASE=%q (expected snake or camel)", jsonCase)
+	}
+	timeFormat := strings.ToLower(src.envStr("TIME_FORMAT", "rfc3339"))
+	switch timeFormat {
+	case "rfc3339", "rfc3339nano", "unixmillis":
+	default:
+		return Config{}, fmt.Errorf("invalid TIME_FORMAT=%q (expected rfc3339, rfc3339nano or unixmillis)", timeFormat)
+	}
+	var probeExtra map[string]any
+	if v := src.envStr("PROBE_EXTRA_JSON", ""); v != "" {
+		if err := json.Unmarshal([]byte(v), &probeExtra); err != nil || probeExtra == nil {
+			return Config{}, fmt.Errorf("invalid PROBE_EXTRA_JSON=%q (expected JSON object)", v)
+		}
+	}
+	unhealthyBody, err := src.probeBody("PROBE_UNHEALTHY_BODY")
+	if err != nil {
+		return Config{}, err
+	}
+	notReadyBody, err := src.probeBody("PROBE_NOTREADY_BODY")
+	if err != nil {
+		return Config{}, err
+	}
+	probePayload, err := src.envInt("PROBE_PAYLOAD_BYTES", 0, 0, 1<<20)
+	if err != nil {
+		return Config{}, err
+	}
+	logSampleRate, err := src.envFloat("LOG_SAMPLE_RATE", 1)
+	if err != nil {
+		return Config{}, err
+	}
+	if logSampleRate > 1 {
+		return Config{}, fmt.Errorf("invalid LOG_SAMPLE_RATE=%q (expected number in [0,1])", src.get("LOG_SAMPLE_RATE"))
+	}
+	logConnState, err := src.envBool("LOG_CONN_STATE", false)
+	if err != nil {
+		return Config{}, err
+	}
+	dumpRequests, err := src.envBool("DEBUG_DUMP_REQUESTS", false)
+	if err != nil {
+		return Config{}, err
+	}
+	logMaxSize, err := src.envInt("LOG_MAX_SIZE_MB", 100, 1, 1<<20)
+	if err != nil {
+		return Config{}, err
+	}
+	logMaxBackups, err := src.envInt("LOG_MAX_BACKUPS", 3, 0, 1000)
+	if err != nil {
+		return Config{}, err
+	}
+	heartbeat, err := src.envDuration("HEARTBEAT_INTERVAL", 0, false)
+	if err != nil {
+		return Config{}, err
+	}
+	enableCompression, err := src.envBool("ENABLE_COMPRESSION", false)
+	if err != nil {
+		return Config{}, err
+	}
+	enableH2C, err := src.envBool("ENABLE_H2C", false)
+	if err != nil {
+		return Config{}, err
+	}
+	enableProxyProtocol, err := src.envBool("ENABLE_PROXY_PROTOCOL", false)
+	if err != nil {
+		return Config{}, err
+	}
+	enablePprof, err := src.envBool("ENABLE_PPROF", false)
+	if err != nil {
+		return Config{}, err
+	}
+	enableTLSReflect, err := src.envBool("ENABLE_TLS_REFLECT", false)
+	if err != nil {
+		return Config{}, err
+	}
+	rateRPS, err := src.envFloat("RATE_LIMIT_RPS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	rateBurst, err := src.envInt("RATE_LIMIT_BURST", max(int(math.Ceil(rateRPS)), 1), 1, 1_000_000)
+	if err != nil {
+		return Config{}, err
+	}
+	ratePerIP, err := src.envBool("RATE_LIMIT_PER_IP", false)
+	if err != nil {
+		return Config{}, err
+	}
+	securityHeaders, err := src.envBool("ENABLE_SECURITY_HEADERS", false)
+	if err != nil {
+		return Config{}, err
+	}
+	staticDir := src.envStr("STATIC_DIR", "")
+	if staticDir != "" {
+		if fi, err := os.Stat(staticDir); err != nil || !fi.IsDir() {
+			return Config{}, fmt.Errorf("invalid STATIC_DIR=%q (expected existing directory)", staticDir)
+		}
+	}
+	staticMaxAge, err := src.envDuration("STATIC_MAX_AGE", time.Hour, false)
+	if err != nil {
+		return Config{}, err
+	}
+	hstsMaxAge, err := src.envDuration("HSTS_MAX_AGE", 365*24*time.Hour, false)
+	if err != nil {
+		return Config{}, err
+	}
+	adminToken := src.envStr("ADMIN_TOKEN", "")
+	remoteShutdown, err := src.envBool("ENABLE_REMOTE_SHUTDOWN", false)
+	if err != nil {
+		return Config{}, err
+	}
+	if remoteShutdown && adminToken == "" {
+		return Config{}, fmt.Errorf("invalid ENABLE_REMOTE_SHUTDOWN=%q (requires ADMIN_TOKEN)", src.get("ENABLE_REMOTE_SHUTDOWN"))
+	}
+	adminEnabled, err := src.envBool("ADMIN_ENABLED", true)
 	if err != nil {
 		return Config{}, err
 	}
-	startupDelay, err := envDuration("STARTUP_DELAY", 30*time.Second, false)
+	adminResetEnabled, err := src.envBool("ADMIN_RESET_ENABLED", true)
 	if err != nil {
 		return Config{}, err
 	}
-	shutdownWait, err := envDuration("SHUTDOWN_WAIT", 10*time.Second, false)
+	resetMinInterval, err := src.envDuration("RESET_MIN_INTERVAL", 0, false)
 	if err != nil {
 		return Config{}, err
 	}
-	readTimeout, err := envDuration("READ_TIMEOUT", 15*time.Second, false)
+	enableTracing, err := src.envBool("ENABLE_TRACING", false)
 	if err != nil {
 		return Config{}, err
 	}
-	writeTimeout, err := envDuration("WRITE_TIMEOUT", 15*time.Second, false)
+	otlpEndpoint := src.envStr("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	if u, err := url.Parse(otlpEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Config{}, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT=%q (expected http(s)://host:port)", otlpEndpoint)
+	}
+	trustedProxies, err := src.envPrefixes("TRUSTED_PROXIES")
 	if err != nil {
 		return Config{}, err
 	}
-	idleTimeout, err := envDuration("IDLE_TIMEOUT", 60*time.Second, false)
+	requestIDMaxLen, err := src.envInt("REQUEST_ID_MAX_LEN", 128, 1, 1024)
 	if err != nil {
 		return Config{}, err
 	}
-	maxBody, err := envInt64("MAX_BODY_BYTES", 1<<20, 1)
+	validateOnly, err := src.envBool("VALIDATE_ONLY", false)
 	if err != nil {
 		return Config{}, err
 	}
+	customHeaders, customSkipped := parseCustomHeaders(src.envStr("CUSTOM_HEADERS", ""))
+	tlsCert := src.envStr("TLS_CERT_FILE", "")
+	tlsKey := src.envStr("TLS_KEY_FILE", "")
+	if (tlsCert == "") != (tlsKey == "") {
+		return Config{}, fmt.Errorf("invalid TLS_CERT_FILE=%q / TLS_KEY_FILE=%q (both or neither must be set)", tlsCert, tlsKey)
+	}
+	tlsClientCA := src.envStr("TLS_CLIENT_CA", "")
+	if tlsClientCA != "" && (tlsCert == "" || adminPort == 0 || adminPort == port) {
+		return Config{}, fmt.Errorf("invalid TLS_CLIENT_CA=%q (requires TLS_CERT_FILE/TLS_KEY_FILE and an ADMIN_PORT different from PORT)", tlsClientCA)
+	}
+	if tlsClientCA != "" {
+		f, err := os.Open(tlsClientCA)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TLS_CLIENT_CA=%q (expected readable file)", tlsClientCA)
+		}
+		f.Close()
+	}
 
 	return Config{
-		Port:         port,
-		StartupDelay: startupDelay,
-		ServiceName:  envStr("SERVICE_NAME", "probe-service"),
-		Version:      envStr("VERSION", "1.0.0"),
-		ShutdownWait: shutdownWait,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
-		IdleTimeout:  idleTimeout,
-		MaxBodyBytes: maxBody,
-		LogLevel:     parseLogLevel(envStr("LOG_LEVEL", "info")),
+		Port:                    port,
+		AdminPort:               adminPort,
+		BindAddr:                bindAddr,
+		AdminBindAddr:           adminBindAddr,
+		ListenNetwork:           listenNetwork,
+		ListenAddr:              listenAddr,
+		ListenFD:                listenFD,
+		ReusePort:               reusePort,
+		ListenRetryCount:        listenRetryCount,
+		ListenRetryDelay:        listenRetryDelay,
+		StartupDelay:            startupDelay,
+		HealthStartupDelay:      healthDelay,
+		ReadyStartupDelay:       readyDelay,
+		ReadyRamp:               readyRamp,
+		StartupProbeDelay:       startupProbeDelay,
+		StartupDelayJitter:      delayJitter,
+		WarmupDuration:          warmupDuration,
+		HealthTTL:               healthTTL,
+		HealthScript:            healthScript,
+		ReadyTTL:                readyTTL,
+		HealthFailAfterRequests: failAfter,
+		HealthGraceAfterUnready: healthGrace,
+		HealthFailureRate:       failureRate,
+		HealthCheckCmd:          src.envStr("HEALTH_CHECK_CMD", ""),
+		HealthCheckInterval:     checkInterval,
+		HealthCheckTimeout:      checkTimeout,
+		MinFreeDiskBytes:        minFreeDisk,
+		DiskCheckPath:           diskCheckPath,
+		MaxHeapBytes:            maxHeap,
+		ServiceName:             src.envStr("SERVICE_NAME", "probe-service"),
+		Version:                 src.envStr("VERSION", o.defaultVersion),
+		ShutdownWait:            shutdownWait,
+		ShutdownHookTimeout:     hookTimeout,
+		PreStopDelay:            preStopDelay,
+		DrainCloseIdle:          drainCloseIdle,
+		ReadTimeout:             readTimeout,
+		WriteTimeout:            writeTimeout,
+		IdleTimeout:             idleTimeout,
+		DisableKeepAlive:        disableKeepAlive,
+		MaxConnections:          maxConns,
+		MaxBodyBytes:            maxBody,
+		MaxHeaderBytes:          maxHeader,
+		LogLevel:                parseLogLevel(src.envStr("LOG_LEVEL", "info")),
+		LogFormat:               logFormat,
+		ProbeResponseFormat:     probeFormat,
+		JSONCase:                jsonCase,
+		TimeFormat:              timeFormat,
+		ProbeExtra:              probeExtra,
+		ProbeUnhealthyBody:      unhealthyBody,
+		ProbeNotReadyBody:       notReadyBody,
+		ProbePayloadBytes:       probePayload,
+		LogSampleRate:           logSampleRate,
+		LogConnState:            logConnState,
+		DebugDumpRequests:       dumpRequests,
+		LogFile:                 src.envStr("LOG_FILE", ""),
+		LogMaxSizeMB:            logMaxSize,
+		LogMaxBackups:           logMaxBackups,
+		PodName:                 src.envStr("POD_NAME", ""),
+		PodNamespace:            src.envStr("POD_NAMESPACE", ""),
+		NodeName:                src.envStr("NODE_NAME", ""),
+		HeartbeatInterval:       heartbeat,
+		TLSCertFile:             tlsCert,
+		TLSKeyFile:              tlsKey,
+		TLSClientCA:             tlsClientCA,
+		AdminToken:              adminToken,
+		ReadyDependencyURL:      depURL,
+		ReadyDependencyTimeout:  depTimeout,
+		ReadyDependencyTTL:      depTTL,
+		ReadyChecks:             readyChecks,
+		ReadyFile:               src.envStr("READY_FILE", ""),
+		ReadyFileNonEmpty:       readyFileNonEmpty,
+		ReadyAfterHealthChecks:  readyAfterHealthChecks,
+		ResponseDelay:           responseDelay,
+		EnableCompression:       enableCompression,
+		EnableH2C:               enableH2C,
+		EnableProxyProtocol:     enableProxyProtocol,
+		EnablePprof:             enablePprof,
+		EnableTLSReflect:        enableTLSReflect,
+		StaticDir:               staticDir,
+		StaticMaxAge:            staticMaxAge,
+		RateLimitRPS:            rateRPS,
+		RateLimitBurst:          rateBurst,
+		RateLimitPerIP:          ratePerIP,
+		TrustedProxies:          trustedProxies,
+		EnableSecurityHeaders:   securityHeaders,
+		HSTSMaxAge:              hstsMaxAge,
+		EnableTracing:           enableTracing,
+		EnableRemoteShutdown:    remoteShutdown,
+		AdminDisabled:           !adminEnabled,
+		AdminResetDisabled:      !adminResetEnabled,
+		ResetMinInterval:        resetMinInterval,
+		OTLPEndpoint:            otlpEndpoint,
+		ValidateOnly:            validateOnly,
+		CORSAllowedOrigins:      src.envList("CORS_ALLOWED_ORIGINS"),
+		CustomHeaders:           customHeaders,
+		CustomHeadersSkipped:    customSkipped,
+		RequestIDHeader:         http.CanonicalHeaderKey(src.envStr("REQUEST_ID_HEADER", "X-Request-Id")),
+		RequestIDMaxLen:         requestIDMaxLen,
+		ResponseDelayMax:        responseDelayMax,
+		HandlerTimeout:          handlerTimeout,
 	}, nil
 }
 
+// systemdListenFD returns the first socket passed by systemd socket
+// activation (fd 3), or 0 if the process was not socket-activated:
+// LISTEN_FDS must be at least 1 and LISTEN_PID must be this process.
+// Further sockets are ignored.
+func systemdListenFD() int {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	if n, err := strconv.Atoi(os.Getenv("LISTEN_FDS")); err != nil || n < 1 {
+		return 0
+	}
+	return 3
+}
+
+// parseEnvPrefix validates ENV_PREFIX and returns it with a trailing "_",
+// or "" if unset. A trailing "_" in the value is optional.
+func parseEnvPrefix(v string) (string, error) {
+	prefix := strings.TrimSuffix(strings.TrimSpace(v), "_")
+	if prefix == "" {
+		return "", nil
+	}
+	for _, c := range prefix {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			return "", fmt.Errorf("invalid ENV_PREFIX=%q (expected letters, digits and underscores)", v)
+		}
+	}
+	return prefix + "_", nil
+}
+
+// readyChecks collects READY_CHECK_TCP_<NAME> and READY_CHECK_HTTP_<NAME>
+// into ReadyChecks sorted by name.
+func (s *source) readyChecks() ([]ReadyCheck, error) {
+	var out []ReadyCheck
+	for _, kind := range []string{"tcp", "http"} {
+		prefix := "READY_CHECK_" + strings.ToUpper(kind) + "_"
+		for name, target := range s.withPrefix(prefix) {
+			key := prefix + name
+			target = strings.TrimSpace(target)
+			if name == "" {
+				return nil, fmt.Errorf("invalid %s (missing check name)", key)
+			}
+			switch kind {
+			case "tcp":
+				if _, _, err := net.SplitHostPort(target); err != nil {
+					return nil, fmt.Errorf("invalid %s=%q (expected host:port)", key, target)
+				}
+			case "http":
+				if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return nil, fmt.Errorf("invalid %s=%q (expected http(s)://host/…)", key, target)
+				}
+			}
+			out = append(out, ReadyCheck{Name: strings.ToLower(name), Kind: kind, Target: target})
+		}
+	}
+	slices.SortFunc(out, func(a, b ReadyCheck) int { return strings.Compare(a.Name, b.Name) })
+	for i := 1; i < len(out); i++ {
+		if out[i].Name == out[i-1].Name {
+			return nil, fmt.Errorf("invalid READY_CHECK_*_%s (name used more than once)", strings.ToUpper(out[i].Name))
+		}
+	}
+	return out, nil
+}
+
 // envStr returns the trimmed environment variable for key, or def if empty.
-func envStr(key, def string) string {
-	v := strings.TrimSpace(os.Getenv(key))
+func (s *source) envStr(key, def string) string {
+	v := strings.TrimSpace(s.get(key))
 	if v == "" {
 		return def
 	}
 	return v
 }
 
+// probeBody parses a custom probe body env var. A value starting with
+// "{" or "[" is taken as JSON and must be valid; anything else is text.
+func (s *source) probeBody(key string) (ProbeBody, error) {
+	v := s.envStr(key, "")
+	b := ProbeBody{Content: v, JSON: strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[")}
+	if b.JSON && !json.Valid([]byte(v)) {
+		return ProbeBody{}, fmt.Errorf("invalid %s=%q (expected valid JSON or plain text)", key, v)
+	}
+	return b, nil
+}
+
+// envHost parses a bind address env var: an IP address (IPv4 or IPv6,
+// without brackets or zone), returned in canonical form, or a DNS host
+// name, returned lower-cased. It returns def if empty. The port is never
+// part of the value; Listen adds it with net.JoinHostPort, which brackets
+// IPv6 literals.
+func (s *source) envHost(key, def string) (string, error) {
+	v := strings.TrimSpace(s.get(key))
+	if v == "" {
+		return def, nil
+	}
+	if ip, err := netip.ParseAddr(v); err == nil && ip.Zone() == "" {
+		return ip.String(), nil
+	}
+	if !isHostname(v) {
+		return "", fmt.Errorf("invalid %s=%q (expected IP address or host name)", key, v)
+	}
+	return strings.ToLower(v), nil
+}
+
+// isHostname reports whether v is a syntactically valid DNS host name
+// (RFC 1123): dot-separated labels of 1-63 letters, digits and hyphens,
+// not starting or ending with a hyphen. An all-numeric last label is
+// rejected so that malformed IPv4 addresses are not taken for names.
+func isHostname(v string) bool {
+	v = strings.TrimSuffix(v, ".")
+	if v == "" || len(v) > 253 {
+		return false
+	}
+	labels := strings.Split(v, ".")
+	for _, l := range labels {
+		if len(l) == 0 || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+		for _, c := range l {
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	last := labels[len(labels)-1]
+	return strings.Trim(last, "0123456789") != ""
+}
+
+// envList splits a comma-separated env var into trimmed, non-empty
+// elements. It returns nil if the variable is unset or empty.
+func (s *source) envList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(s.get(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envPrefixes parses a comma-separated list of CIDRs or bare IPs (which
+// are turned into single-address prefixes). It returns nil if the
+// variable is unset or empty.
+func (s *source) envPrefixes(key string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, v := range s.envList(key) {
+		if !strings.Contains(v, "/") {
+			ip, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s entry %q (expected CIDR or IP)", key, v)
+			}
+			ip = ip.Unmap()
+			out = append(out, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q (expected CIDR or IP)", key, v)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// envBool parses a boolean env var using strconv.ParseBool semantics
+// (1/0, true/false, t/f, …).
+func (s *source) envBool(key string, def bool) (bool, error) {
+	v := strings.TrimSpace(s.get(key))
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s=%q (expected true or false)", key, v)
+	}
+	return b, nil
+}
+
 // envInt parses an int env var and ensures it lies within [min, max].
-func envInt(key string, def, minVal, maxVal int) (int, error) {
-	v := strings.TrimSpace(os.Getenv(key))
+func (s *source) envInt(key string, def, minVal, maxVal int) (int, error) {
+	v := strings.TrimSpace(s.get(key))
 	if v == "" {
 		return def, nil
 	}
@@ -120,8 +1211,8 @@ func envInt(key string, def, minVal, maxVal int) (int, error) {
 }
 
 // envInt64 parses an int64 env var and ensures it is >= minVal.
-func envInt64(key string, def, minVal int64) (int64, error) {
-	v := strings.TrimSpace(os.Getenv(key))
+func (s *source) envInt64(key string, def, minVal int64) (int64, error) {
+	v := strings.TrimSpace(s.get(key))
 	if v == "" {
 		return def, nil
 	}
@@ -132,10 +1223,23 @@ func envInt64(key string, def, minVal int64) (int64, error) {
 	return n, nil
 }
 
+// envFloat parses a non-negative float64 env var.
+func (s *source) envFloat(key string, def float64) (float64, error) {
+	v := strings.TrimSpace(s.get(key))
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("invalid %s=%q (expected number >= 0)", key, v)
+	}
+	return f, nil
+}
+
 // envDuration parses a time.Duration env var. If allowNegative is false,
 // negative durations are rejected.
-func envDuration(key string, def time.Duration, allowNegative bool) (time.Duration, error) {
-	v := strings.TrimSpace(os.Getenv(key))
+func (s *source) envDuration(key string, def time.Duration, allowNegative bool) (time.Duration, error) {
+	v := strings.TrimSpace(s.get(key))
 	if v == "" {
 		return def, nil
 	}
@@ -146,6 +1250,49 @@ func envDuration(key string, def time.Duration, allowNegative bool) (time.Durati
 	return d, nil
 }
 
+// parseCustomHeaders parses "Key:Value" pairs separated by semicolons.
+// Entries without a colon, with a name that is not an HTTP token, or with
+// control characters in the value are returned in skipped instead of
+// failing Load, so that one typo does not keep the service from starting.
+func parseCustomHeaders(s string) (h http.Header, skipped []string) {
+	for _, entry := range strings.Split(s, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !isToken(name) || strings.ContainsFunc(value, isCTL) {
+			skipped = append(skipped, entry)
+			continue
+		}
+		if h == nil {
+			h = make(http.Header)
+		}
+		h.Add(name, value)
+	}
+	return h, skipped
+}
+
+// isToken reports whether s is a non-empty RFC 9110 token, the syntax of
+// a header field name.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isCTL reports whether r is a control character other than tab.
+func isCTL(r rune) bool { return (r < 0x20 && r != '\t') || r == 0x7f }
+
 // parseLogLevel maps a string to a slog.Level. Unknown values fall back to info.
 func parseLogLevel(s string) slog.Level {
 	switch strings.ToLower(strings.TrimSpace(s)) {
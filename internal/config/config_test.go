@@ -2,6 +2,9 @@ package config
 
 import (
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 )
@@ -11,6 +14,8 @@ import (
 func TestLoad_Defaults(t *testing.T) {
 	t.Setenv("PORT", "")
 	t.Setenv("STARTUP_DELAY", "")
+	t.Setenv("HEALTH_STARTUP_DELAY", "")
+	t.Setenv("READY_STARTUP_DELAY", "")
 	t.Setenv("SERVICE_NAME", "")
 	t.Setenv("VERSION", "")
 	t.Setenv("SHUTDOWN_WAIT", "")
@@ -18,7 +23,9 @@ func TestLoad_Defaults(t *testing.T) {
 	t.Setenv("WRITE_TIMEOUT", "")
 	t.Setenv("IDLE_TIMEOUT", "")
 	t.Setenv("MAX_BODY_BYTES", "")
+	t.Setenv("MAX_HEADER_BYTES", "")
 	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_FORMAT", "")
 
 	c, err := Load()
 	if err != nil {
@@ -31,18 +38,40 @@ func TestLoad_Defaults(t *testing.T) {
 	if c.StartupDelay != 30*time.Second {
 		t.Errorf("StartupDelay = %v, want 30s", c.StartupDelay)
 	}
+	if c.HealthStartupDelay != 30*time.Second || c.ReadyStartupDelay != 30*time.Second {
+		t.Errorf("Health/ReadyStartupDelay = %v/%v, want 30s/30s", c.HealthStartupDelay, c.ReadyStartupDelay)
+	}
 	if c.ServiceName != "probe-service" {
 		t.Errorf("ServiceName = %q, want %q", c.ServiceName, "probe-service")
 	}
-	if c.Version != "1.0.0" {
-		t.Errorf("Version = %q, want %q", c.Version, "1.0.0")
+	if c.Version != "dev" {
+		t.Errorf("Version = %q, want %q", c.Version, "dev")
 	}
 	if c.MaxBodyBytes != 1<<20 {
 		t.Errorf("MaxBodyBytes = %d, want %d", c.MaxBodyBytes, 1<<20)
 	}
+	if c.MaxHeaderBytes != 1<<20 {
+		t.Errorf("MaxHeaderBytes = %d, want %d", c.MaxHeaderBytes, 1<<20)
+	}
 	if c.LogLevel != slog.LevelInfo {
 		t.Errorf("LogLevel = %v, want Info", c.LogLevel)
 	}
+	if c.LogFormat != "json" {
+		t.Errorf("LogFormat = %q, want json", c.LogFormat)
+	}
+}
+
+// TestLoad_DefaultVersion verifies that WithDefaultVersion replaces "dev"
+// but not an explicit VERSION.
+func TestLoad_DefaultVersion(t *testing.T) {
+	t.Setenv("VERSION", "")
+	if c, err := Load(WithDefaultVersion("1.2.3")); err != nil || c.Version != "1.2.3" {
+		t.Errorf("Load(WithDefaultVersion) = %q, %v; want 1.2.3", c.Version, err)
+	}
+	t.Setenv("VERSION", "2.0.0")
+	if c, err := Load(WithDefaultVersion("1.2.3")); err != nil || c.Version != "2.0.0" {
+		t.Errorf("Load(WithDefaultVersion) with VERSION = %q, %v; want 2.0.0", c.Version, err)
+	}
 }
 
 // TestLoad_Overrides verifies that all supported variables are honoured.
@@ -52,7 +81,9 @@ func TestLoad_Overrides(t *testing.T) {
 	t.Setenv("SERVICE_NAME", "probe")
 	t.Setenv("VERSION", "2.3.4")
 	t.Setenv("MAX_BODY_BYTES", "2048")
+	t.Setenv("MAX_HEADER_BYTES", "4096")
 	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "TEXT")
 
 	c, err := Load()
 	if err != nil {
@@ -74,9 +105,34 @@ func TestLoad_Overrides(t *testing.T) {
 	if c.MaxBodyBytes != 2048 {
 		t.Errorf("MaxBodyBytes = %d, want 2048", c.MaxBodyBytes)
 	}
+	if c.MaxHeaderBytes != 4096 {
+		t.Errorf("MaxHeaderBytes = %d, want 4096", c.MaxHeaderBytes)
+	}
 	if c.LogLevel != slog.LevelDebug {
 		t.Errorf("LogLevel = %v, want Debug", c.LogLevel)
 	}
+	if c.LogFormat != "text" {
+		t.Errorf("LogFormat = %q, want text", c.LogFormat)
+	}
+}
+
+// TestLoad_PerFlagStartupDelay verifies that HEALTH_STARTUP_DELAY and
+// READY_STARTUP_DELAY override STARTUP_DELAY independently.
+func TestLoad_PerFlagStartupDelay(t *testing.T) {
+	t.Setenv("STARTUP_DELAY", "10s")
+	t.Setenv("HEALTH_STARTUP_DELAY", "1s")
+	t.Setenv("READY_STARTUP_DELAY", "")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if c.HealthStartupDelay != time.Second {
+		t.Errorf("HealthStartupDelay = %v, want 1s", c.HealthStartupDelay)
+	}
+	if c.ReadyStartupDelay != 10*time.Second {
+		t.Errorf("ReadyStartupDelay = %v, want 10s (fallback)", c.ReadyStartupDelay)
+	}
 }
 
 // TestLoad_InvalidValues verifies that bad input produces an error
@@ -90,10 +146,81 @@ func TestLoad_InvalidValues(t *testing.T) {
 		{"port not int", "PORT", "abc"},
 		{"port out of range", "PORT", "70000"},
 		{"port zero", "PORT", "0"},
+		{"admin port out of range", "ADMIN_PORT", "70000"},
 		{"duration garbage", "STARTUP_DELAY", "not-a-duration"},
 		{"duration negative", "STARTUP_DELAY", "-1s"},
+		{"ready delay garbage", "READY_STARTUP_DELAY", "soon"},
+		{"listen network unknown", "LISTEN_NETWORK", "udp"},
+		{"bool garbage", "ENABLE_COMPRESSION", "maybe"},
+		{"log format unknown", "LOG_FORMAT", "xml"},
+		{"dependency url no scheme", "READY_DEPENDENCY_URL", "db:5432"},
+		{"listen addr no port", "LISTEN_ADDR", "localhost"},
 		{"max body zero", "MAX_BODY_BYTES", "0"},
 		{"max body garbage", "MAX_BODY_BYTES", "huge"},
+		{"max header zero", "MAX_HEADER_BYTES", "0"},
+		{"max header negative", "MAX_HEADER_BYTES", "-1"},
+		{"min free disk negative", "MIN_FREE_DISK_BYTES", "-1"},
+		{"min free disk garbage", "MIN_FREE_DISK_BYTES", "1GB"},
+		{"max heap negative", "MAX_HEAP_BYTES", "-1"},
+		{"disable keepalive", "DISABLE_KEEPALIVE", "sometimes"},
+		{"request id max len", "REQUEST_ID_MAX_LEN", "0"},
+		{"probe payload bytes", "PROBE_PAYLOAD_BYTES", "2000000"},
+		{"negative delay jitter", "STARTUP_DELAY_JITTER", "-1s"},
+		{"ready file nonempty", "READY_FILE_NONEMPTY", "maybe"},
+		{"drain close idle", "DRAIN_CLOSE_IDLE", "soon"},
+		{"zero check interval", "HEALTH_CHECK_INTERVAL", "0s"},
+		{"negative check timeout", "HEALTH_CHECK_TIMEOUT", "-1s"},
+		{"debug dump requests", "DEBUG_DUMP_REQUESTS", "verbose"},
+		{"json case", "JSON_CASE", "kebab"},
+		{"negative reset interval", "RESET_MIN_INTERVAL", "-5s"},
+		{"zero hook timeout", "SHUTDOWN_HOOK_TIMEOUT", "0"},
+		{"non-bool reuseport", "REUSEPORT", "maybe"},
+		{"negative health checks", "READY_AFTER_HEALTH_CHECKS", "-1"},
+		{"missing static dir", "STATIC_DIR", "/nonexistent/probe-service-static"},
+		{"negative static max age", "STATIC_MAX_AGE", "-1s"},
+		{"unknown time format", "TIME_FORMAT", "iso"},
+		{"non-bool validate only", "VALIDATE_ONLY", "maybe"},
+		{"negative listen retries", "LISTEN_RETRY_COUNT", "-1"},
+		{"zero listen retry delay", "LISTEN_RETRY_DELAY", "0"},
+		{"negative health grace", "HEALTH_GRACE_AFTER_UNREADY", "-1s"},
+		{"client CA without TLS", "TLS_CLIENT_CA", "/etc/probe/ca.pem"},
+		{"invalid JSON unhealthy body", "PROBE_UNHEALTHY_BODY", `{"status":`},
+		{"invalid JSON notready body", "PROBE_NOTREADY_BODY", "[1,"},
+		{"bool garbage tls reflect", "ENABLE_TLS_REFLECT", "sometimes"},
+		{"remote shutdown without token", "ENABLE_REMOTE_SHUTDOWN", "true"},
+		{"health ttl negative", "HEALTH_TTL", "-5s"},
+		{"rate limit negative", "RATE_LIMIT_RPS", "-1"},
+		{"rate limit garbage", "RATE_LIMIT_RPS", "fast"},
+		{"rate burst zero", "RATE_LIMIT_BURST", "0"},
+		{"trusted proxy garbage", "TRUSTED_PROXIES", "10.0.0.0/8,proxy"},
+		{"log sample rate above one", "LOG_SAMPLE_RATE", "1.5"},
+		{"otlp endpoint no scheme", "OTEL_EXPORTER_OTLP_ENDPOINT", "collector:4318"},
+		{"tcp check no port", "READY_CHECK_TCP_DB", "db.internal"},
+		{"http check no scheme", "READY_CHECK_HTTP_API", "api.internal/health"},
+		{"tcp check no name", "READY_CHECK_TCP_", "db:5432"},
+		{"admin enabled garbage", "ADMIN_ENABLED", "nope"},
+		{"log max size zero", "LOG_MAX_SIZE_MB", "0"},
+		{"log max backups negative", "LOG_MAX_BACKUPS", "-1"},
+		{"bind addr bracketed", "BIND_ADDR", "[::1]"},
+		{"bind addr bad hostname", "BIND_ADDR", "-probe.example"},
+		{"probe format unknown", "PROBE_RESPONSE_FORMAT", "xml"},
+		{"fail after negative", "HEALTH_FAIL_AFTER_REQUESTS", "-1"},
+		{"failure rate above one", "HEALTH_FAILURE_RATE", "2"},
+		{"bind addr with port", "BIND_ADDR", "127.0.0.1:8080"},
+		{"admin bind addr garbage", "ADMIN_BIND_ADDR", "10.0.0.300"},
+		{"max connections negative", "MAX_CONNECTIONS", "-1"},
+		{"env prefix with dash", "ENV_PREFIX", "MY-APP"},
+		{"heartbeat interval negative", "HEARTBEAT_INTERVAL", "-5s"},
+		{"health script unknown state", "HEALTH_SCRIPT", "ok:1s,maybe:2s"},
+		{"health script zero duration", "HEALTH_SCRIPT", "ok:0s"},
+		{"health script only loop", "HEALTH_SCRIPT", "loop"},
+		{"listen fd below 3", "LISTEN_FD", "2"},
+		{"listen fd not a number", "LISTEN_FD", "three"},
+		{"ready ramp", "READY_RAMP", "maybe"},
+		{"log conn state", "LOG_CONN_STATE", "verbose"},
+		{"probe extra not json", "PROBE_EXTRA_JSON", "{region: eu}"},
+		{"probe extra array", "PROBE_EXTRA_JSON", `["eu"]`},
+		{"probe extra null", "PROBE_EXTRA_JSON", "null"},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -105,6 +232,289 @@ func TestLoad_InvalidValues(t *testing.T) {
 	}
 }
 
+// TestLoad_ReadyChecks verifies that READY_CHECK_* variables become named
+// checks sorted by name, and that a name may only be used once.
+func TestLoad_ReadyChecks(t *testing.T) {
+	t.Setenv("READY_CHECK_TCP_DB", "db.internal:5432")
+	t.Setenv("READY_CHECK_HTTP_API", "http://api.internal/health")
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	want := []ReadyCheck{
+		{Name: "api", Kind: "http", Target: "http://api.internal/health"},
+		{Name: "db", Kind: "tcp", Target: "db.internal:5432"},
+	}
+	if !slices.Equal(c.ReadyChecks, want) {
+		t.Errorf("ReadyChecks = %v, want %v", c.ReadyChecks, want)
+	}
+
+	t.Setenv("READY_CHECK_HTTP_DB", "http://db.internal/health")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load with a duplicate check name returned nil error")
+	}
+}
+
+// TestLoad_CustomHeaders verifies that valid CUSTOM_HEADERS entries are
+// parsed and invalid ones are reported instead of failing Load.
+func TestLoad_CustomHeaders(t *testing.T) {
+	t.Setenv("CUSTOM_HEADERS", "X-Cache: HIT; bad header:x;Via:1.1 cdn ; novalue;X-Cache:STALE")
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if got := c.CustomHeaders.Values("X-Cache"); !slices.Equal(got, []string{"HIT", "STALE"}) {
+		t.Errorf("X-Cache = %v, want [HIT STALE]", got)
+	}
+	if got := c.CustomHeaders.Get("Via"); got != "1.1 cdn" {
+		t.Errorf("Via = %q, want %q", got, "1.1 cdn")
+	}
+	if want := []string{"bad header:x", "novalue"}; !slices.Equal(c.CustomHeadersSkipped, want) {
+		t.Errorf("CustomHeadersSkipped = %q, want %q", c.CustomHeadersSkipped, want)
+	}
+}
+
+// TestLoad_TLSPair verifies that TLS is enabled only when both cert and
+// key are configured, and that a half-configured pair is rejected.
+func TestLoad_TLSPair(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !c.TLSEnabled() {
+		t.Error("TLSEnabled() = false, want true")
+	}
+
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load with only TLS_CERT_FILE returned nil error")
+	}
+
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load with only TLS_KEY_FILE returned nil error")
+	}
+}
+
+// TestLoad_TLSClientCA verifies that TLS_CLIENT_CA must name a readable
+// file once its other requirements are met.
+func TestLoad_TLSClientCA(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, []byte("-----BEGIN CERTIFICATE-----\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	t.Setenv("ADMIN_PORT", "9090")
+	t.Setenv("TLS_CLIENT_CA", ca)
+	if c, err := Load(); err != nil || c.TLSClientCA != ca {
+		t.Fatalf("Load = %q, %v; want TLSClientCA %q", c.TLSClientCA, err, ca)
+	}
+
+	t.Setenv("TLS_CLIENT_CA", filepath.Join(t.TempDir(), "missing.pem"))
+	if _, err := Load(); err == nil {
+		t.Fatal("Load with a missing TLS_CLIENT_CA returned nil error")
+	}
+}
+
+// TestLoad_UnixSocket verifies that LISTEN_NETWORK=unix requires a path
+// and that Listen() reports it unchanged.
+func TestLoad_UnixSocket(t *testing.T) {
+	t.Setenv("LISTEN_NETWORK", "unix")
+	t.Setenv("LISTEN_ADDR", "")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load with unix and no LISTEN_ADDR returned nil error")
+	}
+
+	t.Setenv("LISTEN_ADDR", "/run/probe.sock")
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if n, a := c.Listen(); n != "unix" || a != "/run/probe.sock" {
+		t.Errorf("Listen() = %q, %q; want unix, /run/probe.sock", n, a)
+	}
+}
+
+// TestLoad_BindAddr verifies that BIND_ADDR restricts the main listener
+// and, unless ADMIN_BIND_ADDR is set, the admin listener as well.
+func TestLoad_BindAddr(t *testing.T) {
+	t.Setenv("PORT", "8080")
+	t.Setenv("ADMIN_PORT", "9090")
+	t.Setenv("BIND_ADDR", "10.0.0.5")
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if _, a := c.Listen(); a != "10.0.0.5:8080" {
+		t.Errorf("Listen() addr = %q, want 10.0.0.5:8080", a)
+	}
+	if a := c.AdminListenAddr(); a != "10.0.0.5:9090" {
+		t.Errorf("AdminListenAddr() = %q, want 10.0.0.5:9090", a)
+	}
+
+	t.Setenv("ADMIN_BIND_ADDR", "127.0.0.1")
+	if c, err = Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if a := c.AdminListenAddr(); a != "127.0.0.1:9090" {
+		t.Errorf("AdminListenAddr() = %q, want 127.0.0.1:9090", a)
+	}
+}
+
+// TestLoad_BindAddrForms checks that IPv4, IPv6 and host name binds are
+// joined with the port correctly: IPv6 literals are bracketed, IPv6 is
+// canonicalised and host names are lower-cased.
+func TestLoad_BindAddrForms(t *testing.T) {
+	cases := []struct {
+		bind, listen, admin string
+	}{
+		{"", ":8080", ":9090"},
+		{"192.0.2.10", "192.0.2.10:8080", "192.0.2.10:9090"},
+		{"::1", "[::1]:8080", "[::1]:9090"},
+		{"::", "[::]:8080", "[::]:9090"},
+		{"2001:DB8:0::1", "[2001:db8::1]:8080", "[2001:db8::1]:9090"},
+		{"::ffff:192.0.2.10", "[::ffff:192.0.2.10]:8080", "[::ffff:192.0.2.10]:9090"},
+		{"localhost", "localhost:8080", "localhost:9090"},
+		{"Probe-1.Example.org.", "probe-1.example.org.:8080", "probe-1.example.org.:9090"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.bind, func(t *testing.T) {
+			t.Setenv("PORT", "8080")
+			t.Setenv("ADMIN_PORT", "9090")
+			t.Setenv("BIND_ADDR", tc.bind)
+			c, err := Load()
+			if err != nil {
+				t.Fatalf("Load returned error: %v", err)
+			}
+			if _, a := c.Listen(); a != tc.listen {
+				t.Errorf("Listen() addr = %q, want %q", a, tc.listen)
+			}
+			if a := c.AdminListenAddr(); a != tc.admin {
+				t.Errorf("AdminListenAddr() = %q, want %q", a, tc.admin)
+			}
+		})
+	}
+}
+
+// TestLoad_EnvPrefix verifies that <ENV_PREFIX>_<NAME> takes precedence
+// over <NAME>, which remains a fallback, for plain and prefix-scanned
+// variables alike.
+func TestLoad_EnvPrefix(t *testing.T) {
+	t.Setenv("ENV_PREFIX", "PROBE_")
+	t.Setenv("PORT", "1234")
+	t.Setenv("PROBE_PORT", "9000")
+	t.Setenv("SERVICE_NAME", "unprefixed")
+	t.Setenv("PROBE_READY_CHECK_TCP_DB", "db:5432")
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if c.Port != 9000 {
+		t.Errorf("Port = %d, want 9000 from PROBE_PORT", c.Port)
+	}
+	if c.ServiceName != "unprefixed" {
+		t.Errorf("ServiceName = %q, want the unprefixed fallback", c.ServiceName)
+	}
+	if len(c.ReadyChecks) != 1 || c.ReadyChecks[0].Target != "db:5432" {
+		t.Errorf("ReadyChecks = %+v, want db from PROBE_READY_CHECK_TCP_DB", c.ReadyChecks)
+	}
+	if c.EnvPrefix != "PROBE" {
+		t.Errorf("EnvPrefix = %q, want PROBE", c.EnvPrefix)
+	}
+}
+
+// TestLoad_ConfigFile checks that YAML and JSON files supply values and
+// that the environment takes precedence over them.
+func TestLoad_ConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"probe.yaml": "# probe config\n" +
+			"port: 9090\n" +
+			"startup_delay: 5s  # short\n" +
+			"service_name: \"from-file\"\n" +
+			"cors_allowed_origins: [https://a.example, 'https://b.example']\n",
+		"probe.json": `{"port": 9090, "startup_delay": "5s", "service_name": "from-file",
+			"cors_allowed_origins": ["https://a.example", "https://b.example"]}`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("CONFIG_FILE", path)
+			t.Setenv("SERVICE_NAME", "from-env")
+
+			c, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if c.Port != 9090 || c.StartupDelay != 5*time.Second {
+				t.Errorf("Port/StartupDelay = %d/%v, want 9090/5s from file", c.Port, c.StartupDelay)
+			}
+			if c.ServiceName != "from-env" {
+				t.Errorf("ServiceName = %q, want from-env (env wins)", c.ServiceName)
+			}
+			if len(c.CORSAllowedOrigins) != 2 || c.CORSAllowedOrigins[1] != "https://b.example" {
+				t.Errorf("CORSAllowedOrigins = %q, want both origins", c.CORSAllowedOrigins)
+			}
+		})
+	}
+}
+
+// TestLoad_ConfigFileErrors checks that broken files and unknown keys are
+// rejected.
+func TestLoad_ConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"unknown.yaml": "port: 9090\nstartup_dealy: 5s\n",
+		"nested.yaml":  "tls:\n  cert: a.pem\n",
+		"quote.yaml":   "service_name: \"open\n",
+		"broken.json":  `{"port": 9090`,
+		"object.json":  `{"port": {"value": 9090}}`,
+		"probe.toml":   "port = 9090\n",
+		"invalid.yaml": "port: zero\n",
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("CONFIG_FILE", path)
+			if _, err := Load(); err == nil {
+				t.Fatal("Load returned nil error")
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", filepath.Join(dir, "absent.yaml"))
+		if _, err := Load(); err == nil {
+			t.Fatal("Load returned nil error")
+		}
+	})
+}
+
+// TestEnvList checks comma splitting and trimming.
+func TestEnvList(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example , ,https://b.example")
+	src := &source{used: map[string]bool{}}
+	got := src.envList("CORS_ALLOWED_ORIGINS")
+	if len(got) != 2 || got[0] != "https://a.example" || got[1] != "https://b.example" {
+		t.Errorf("envList = %q, want [https://a.example https://b.example]", got)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	if got := src.envList("CORS_ALLOWED_ORIGINS"); got != nil {
+		t.Errorf("envList(empty) = %q, want nil", got)
+	}
+}
+
 // TestParseLogLevel checks the level-name mapping including fallback.
 func TestParseLogLevel(t *testing.T) {
 	cases := map[string]slog.Level{
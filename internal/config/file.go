@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// source resolves configuration keys. The precedence, highest first, is:
+//
+//  1. the prefixed environment variable, <ENV_PREFIX>_<KEY> (only with
+//     ENV_PREFIX set),
+//  2. the plain environment variable <KEY>, kept as a fallback so that
+//     existing deployments continue to work after adding a prefix,
+//  3. the value read from CONFIG_FILE (if any), whose keys are never
+//     prefixed.
+//
+// Blank environment values count as unset. The source records which file
+// keys were consulted so that Load can reject keys it does not know; for
+// that to work, load must look up every key unconditionally.
+type source struct {
+	path string
+	// envPrefix is ENV_PREFIX including the trailing "_", or "".
+	envPrefix string
+	file      map[string]string
+	used      map[string]bool
+}
+
+// newSource reads the config file at path. An empty path yields a source
+// backed by the environment only. envPrefix is prepended to every key
+// looked up in the environment, as described on source.
+func newSource(path, envPrefix string) (*source, error) {
+	s := &source{path: path, envPrefix: envPrefix, used: make(map[string]bool)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONFIG_FILE=%q: %w", path, err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		s.file, err = parseJSONConfig(data)
+	case ".yaml", ".yml":
+		s.file, err = parseYAMLConfig(data)
+	default:
+		return nil, fmt.Errorf("invalid CONFIG_FILE=%q (expected .json, .yaml or .yml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONFIG_FILE=%q: %w", path, err)
+	}
+	return s, nil
+}
+
+// get returns the value for key following the precedence described on
+// source.
+func (s *source) get(key string) string {
+	s.used[key] = true
+	if v := lookupEnv(s.envPrefix, key); v != "" {
+		return v
+	}
+	return s.file[key]
+}
+
+// lookupEnv returns the non-blank value of <prefix><key>, falling back to
+// <key>, or "" if neither is set.
+func lookupEnv(prefix, key string) string {
+	if prefix != "" {
+		if v := os.Getenv(prefix + key); strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	if v := os.Getenv(key); strings.TrimSpace(v) != "" {
+		return v
+	}
+	return ""
+}
+
+// withPrefix returns all keys starting with prefix, from the environment
+// and the file, with the prefix stripped. Values follow the precedence
+// described on source. The returned keys count as used.
+func (s *source) withPrefix(prefix string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range s.file {
+		if name, ok := strings.CutPrefix(k, prefix); ok {
+			s.used[k] = true
+			out[name] = v
+		}
+	}
+	envPrefixes := []string{prefix}
+	if s.envPrefix != "" {
+		envPrefixes = append(envPrefixes, s.envPrefix+prefix)
+	}
+	for _, p := range envPrefixes {
+		for _, kv := range os.Environ() {
+			k, v, _ := strings.Cut(kv, "=")
+			if name, ok := strings.CutPrefix(k, p); ok && strings.TrimSpace(v) != "" {
+				out[name] = v
+			}
+		}
+	}
+	return out
+}
+
+// checkUnused returns an error naming the file keys that no lookup asked
+// for, which are almost always typos.
+func (s *source) checkUnused() error {
+	var unknown []string
+	for k := range s.file {
+		if !s.used[k] {
+			unknown = append(unknown, strings.ToLower(k))
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	slices.Sort(unknown)
+	return fmt.Errorf("invalid CONFIG_FILE=%q (unknown keys: %s)", s.path, strings.Join(unknown, ", "))
+}
+
+// parseJSONConfig parses a flat JSON object. Values may be strings,
+// numbers, booleans or arrays of those (joined with commas, like list
+// variables in the environment). Keys are upper-cased.
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		arr, ok := v.([]any)
+		if !ok {
+			arr = []any{v}
+		}
+		parts := make([]string, len(arr))
+		for i, e := range arr {
+			s, err := jsonScalar(e)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k, err)
+			}
+			parts[i] = s
+		}
+		out[strings.ToUpper(k)] = strings.Join(parts, ",")
+	}
+	return out, nil
+}
+
+// jsonScalar renders a decoded JSON scalar as the string an environment
+// variable would carry.
+func jsonScalar(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v (expected string, number, bool or list)", v)
+	}
+}
+
+// parseYAMLConfig parses the flat subset of YAML that a config file
+// needs: one "key: value" pair per line, "#" comments, single- or
+// double-quoted strings and flow lists ("[a, b]", joined with commas).
+// Nested mappings and block lists are rejected.
+func parseYAMLConfig(data []byte) (map[string]string, error) {
+	out := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line != trimmed {
+			return nil, fmt.Errorf("line %d: nested values are not supported", n)
+		}
+		key, val, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		v, err := yamlValue(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		out[strings.ToUpper(key)] = v
+	}
+	return out, sc.Err()
+}
+
+// yamlValue decodes a scalar or flow list as described on
+// parseYAMLConfig.
+func yamlValue(v string) (string, error) {
+	if strings.HasPrefix(v, "[") {
+		end := strings.LastIndex(v, "]")
+		if rest := strings.TrimSpace(v[end+1:]); end < 0 || (rest != "" && !strings.HasPrefix(rest, "#")) {
+			return "", fmt.Errorf("unterminated list %q", v)
+		}
+		var parts []string
+		for _, e := range strings.Split(v[1:end], ",") {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+			s, err := yamlScalar(e)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return yamlScalar(v)
+}
+
+// yamlScalar unquotes a quoted scalar and strips a trailing " # comment".
+func yamlScalar(v string) (string, error) {
+	if v == "" || (v[0] != '"' && v[0] != '\'') {
+		if i := strings.Index(v, " #"); i >= 0 {
+			v = v[:i]
+		}
+		return strings.TrimSpace(v), nil
+	}
+
+	q := v[0]
+	end := -1
+	for i := 1; i < len(v); i++ {
+		switch {
+		case q == '"' && v[i] == '\\':
+			i++ // skip the escaped character
+		case v[i] == q && q == '\'' && i+1 < len(v) && v[i+1] == '\'':
+			i++ // '' is an escaped quote
+		case v[i] == q:
+			end = i
+		}
+		if end >= 0 {
+			break
+		}
+	}
+	if rest := strings.TrimSpace(v[end+1:]); end < 0 || (rest != "" && !strings.HasPrefix(rest, "#")) {
+		return "", fmt.Errorf("invalid quoted string %s", v)
+	}
+	if q == '\'' {
+		return strings.ReplaceAll(v[1:end], "''", "'"), nil
+	}
+	s, err := strconv.Unquote(v[:end+1])
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted string %s", v)
+	}
+	return s, nil
+}
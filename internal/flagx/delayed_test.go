@@ -1,141 +0,0 @@
-package flagx
-
-import (
-	"sync"
-	"testing"
-	"time"
-)
-
-// TestDelayedFlag_ZeroDelayImmediatelyTrue ensures that a zero or negative
-// delay produces a flag that is already true at construction time.
-func TestDelayedFlag_ZeroDelayImmediatelyTrue(t *testing.T) {
-	for _, d := range []time.Duration{0, -1 * time.Second} {
-		f := NewDelayedFlag(d)
-		if !f.Load() {
-			t.Errorf("NewDelayedFlag(%v).Load() = false, want true", d)
-		}
-		if f.Remaining() != 0 {
-			t.Errorf("NewDelayedFlag(%v).Remaining() = %v, want 0", d, f.Remaining())
-		}
-	}
-}
-
-// TestDelayedFlag_FlipsAfterDelay verifies the basic happy path.
-func TestDelayedFlag_FlipsAfterDelay(t *testing.T) {
-	f := NewDelayedFlag(40 * time.Millisecond)
-
-	if f.Load() {
-		t.Fatal("flag true immediately after construction with non-zero delay")
-	}
-	if f.Remaining() <= 0 {
-		t.Errorf("Remaining() = %v, want > 0", f.Remaining())
-	}
-
-	// Wait comfortably past the delay.
-	time.Sleep(100 * time.Millisecond)
-
-	if !f.Load() {
-		t.Fatal("flag still false after delay elapsed")
-	}
-	if f.Remaining() != 0 {
-		t.Errorf("Remaining() after flip = %v, want 0", f.Remaining())
-	}
-}
-
-// TestDelayedFlag_ResetRestartsDelay ensures Reset() forces the flag back
-// to false and reapplies the configured delay.
-func TestDelayedFlag_ResetRestartsDelay(t *testing.T) {
-	f := NewDelayedFlag(20 * time.Millisecond)
-
-	time.Sleep(60 * time.Millisecond)
-	if !f.Load() {
-		t.Fatal("precondition: flag should be true after first delay")
-	}
-
-	f.Reset()
-	if f.Load() {
-		t.Fatal("flag still true immediately after Reset")
-	}
-	if f.Remaining() <= 0 {
-		t.Errorf("Remaining() after Reset = %v, want > 0", f.Remaining())
-	}
-
-	time.Sleep(60 * time.Millisecond)
-	if !f.Load() {
-		t.Fatal("flag still false after second delay")
-	}
-}
-
-// TestDelayedFlag_ResetRaceWithExpiry stresses the race between a timer
-// firing and a concurrent Reset(). After the dust settles, the flag must
-// be false and a fresh deadline must be pending. This is the regression
-// test for the bug present in the original implementation.
-func TestDelayedFlag_ResetRaceWithExpiry(t *testing.T) {
-	const iterations = 200
-
-	for i := 0; i < iterations; i++ {
-		f := NewDelayedFlag(1 * time.Millisecond)
-
-		// Race: timer is about to fire, and we Reset concurrently.
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			time.Sleep(time.Millisecond) // align with timer expiry window
-			f.Reset()
-		}()
-		wg.Wait()
-
-		// After Reset, the flag must be false. We sleep a tick to let any
-		// stray callback (incorrectly) try to flip it.
-		time.Sleep(200 * time.Microsecond)
-
-		// Note: we cannot assert it's *still* false here because the new
-		// 1ms timer may legitimately have already fired. The invariant we
-		// care about is that after the latest Reset, the flag eventually
-		// reflects ONE deterministic outcome (true after delay) and never
-		// flips back to false on its own.
-		// So we sample at a known-good time after a clean Reset:
-		f.Reset()
-		if f.Load() {
-			t.Fatalf("iter %d: flag true immediately after Reset", i)
-		}
-	}
-}
-
-// TestDelayedFlag_ConcurrentLoad exercises Load under hammering Resets
-// to make `go test -race` catch any unsynchronised access.
-func TestDelayedFlag_ConcurrentLoad(t *testing.T) {
-	f := NewDelayedFlag(50 * time.Millisecond)
-
-	stop := make(chan struct{})
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
-			select {
-			case <-stop:
-				return
-			default:
-				f.Reset()
-			}
-		}
-	}()
-
-	wg.Add(4)
-	for i := 0; i < 4; i++ {
-		go func() {
-			defer wg.Done()
-			for j := 0; j < 10_000; j++ {
-				_ = f.Load()
-				_ = f.Remaining()
-			}
-		}()
-	}
-
-	time.Sleep(50 * time.Millisecond)
-	close(stop)
-	wg.Wait()
-}
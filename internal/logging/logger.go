@@ -2,16 +2,24 @@
 package logging
 
 import (
+	"io"
 	"log/slog"
-	"os"
 	"time"
 )
 
-// New returns a JSON slog logger writing to stdout, configured to emit
-// the timestamp in RFC3339 (no fractional seconds) for consistency with
-// the JSON responses returned by the HTTP service.
-func New(level slog.Level) *slog.Logger {
-	h := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+// New returns a slog logger writing to w (usually os.Stdout or a
+// RotatingFile), configured to emit the timestamp in RFC3339 (no
+// fractional seconds) for consistency with the JSON responses returned by
+// the HTTP service.
+//
+// level is typically a *slog.LevelVar so that the level can be changed
+// while the process runs (see the SIGHUP handling in main).
+//
+// format selects the handler: "text" uses slog.TextHandler, anything else
+// (including "" and "json") uses slog.JSONHandler. Validation of the
+// format string is the caller's job (see config.Load).
+func New(w io.Writer, level slog.Leveler, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{
 		Level: level,
 		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
 			if a.Key == slog.TimeKey {
@@ -20,6 +28,36 @@ func New(level slog.Level) *slog.Logger {
 			}
 			return a
 		},
-	})
+	}
+	var h slog.Handler
+	if format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
 	return slog.New(h)
 }
+
+// WithDeployment returns log with a "deployment" group holding the
+// non-empty values of pod, namespace and node (POD_NAME, POD_NAMESPACE,
+// NODE_NAME), so every line can be attributed to its pod:
+//
+//	"deployment": {"pod": "...", "namespace": "...", "node": "..."}
+//
+// If all three are empty log is returned unchanged.
+func WithDeployment(log *slog.Logger, pod, namespace, node string) *slog.Logger {
+	var attrs []any
+	for _, a := range []slog.Attr{
+		slog.String("pod", pod),
+		slog.String("namespace", namespace),
+		slog.String("node", node),
+	} {
+		if a.Value.String() != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	if len(attrs) == 0 {
+		return log
+	}
+	return log.With(slog.Group("deployment", attrs...))
+}
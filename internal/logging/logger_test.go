@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+// TestWithDeployment checks that set values appear in the "deployment"
+// group, empty ones are left out, and no group is added when all are
+// empty.
+func TestWithDeployment(t *testing.T) {
+	var buf bytes.Buffer
+	log := WithDeployment(New(&buf, slog.LevelInfo, "json"), "probe-7f9c", "", "node-1")
+	log.Info("hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decode %q: %v", buf.String(), err)
+	}
+	dep, ok := line["deployment"].(map[string]any)
+	if !ok {
+		t.Fatalf("deployment = %v, want object", line["deployment"])
+	}
+	if dep["pod"] != "probe-7f9c" || dep["node"] != "node-1" {
+		t.Errorf("deployment = %v, want pod and node", dep)
+	}
+	if _, ok := dep["namespace"]; ok {
+		t.Errorf("deployment = %v, want no empty namespace", dep)
+	}
+
+	buf.Reset()
+	WithDeployment(New(&buf, slog.LevelInfo, "json"), "", "", "").Info("hello")
+	if bytes.Contains(buf.Bytes(), []byte("deployment")) {
+		t.Errorf("log line = %s, want no deployment group", buf.Bytes())
+	}
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an io.WriteCloser that appends to a file and rotates it
+// once it would grow beyond a size limit: path is renamed to path.1,
+// path.1 to path.2 and so on, keeping at most a configured number of
+// backups. It is safe for concurrent use.
+type RotatingFile struct {
+	path     string
+	maxBytes int64
+	backups  int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens (or creates) path for appending. A maxBytes of
+// zero or less disables rotation; backups of zero truncates the file on
+// rotation instead of keeping old content.
+func OpenRotatingFile(path string, maxBytes int64, backups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxBytes: maxBytes, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write appends p, rotating first if p would push the file past the
+// limit. A single write is never split across files.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close syncs and closes the current file. Further writes fail.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Sync()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	r.f = nil
+	return err
+}
+
+// open opens r.path for appending and records its current size.
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+// rotate closes the current file, shifts the backups and reopens path.
+// The file is reopened even if shifting fails, so that logging carries on
+// (into the old file) after a rotation error. The caller must hold r.mu.
+func (r *RotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	if err == nil {
+		err = r.shift()
+	}
+	if oerr := r.open(); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+// shift moves path to path.1 and every path.N to path.N+1, dropping the
+// oldest backup. Without backups it truncates path instead.
+func (r *RotatingFile) shift() error {
+	if r.backups == 0 {
+		return os.Truncate(r.path, 0)
+	}
+	// The oldest backup is overwritten by the first rename.
+	for i := r.backups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", r.path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(r.path, r.path+".1")
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRotatingFile verifies that the file is rotated before a write would
+// exceed the limit and that only the configured number of backups is kept.
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for p, content := range want {
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("read %s: %v", filepath.Base(p), err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", filepath.Base(path))
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write after Close returned nil error")
+	}
+}
@@ -0,0 +1,219 @@
+// Package metrics implements a tiny, dependency-free metrics registry
+// that renders the Prometheus text exposition format (version 0.0.4).
+// It covers exactly what the probe service needs: a request counter, a
+// request-duration histogram and callback-based gauges. It is not a
+// general-purpose replacement for client_golang.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// ContentType is the media type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds (in seconds) of the request-duration
+// histogram. They mirror the Prometheus client defaults.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// requestKey identifies one http_requests_total series.
+type requestKey struct {
+	path   string
+	status int
+}
+
+// histogram holds the cumulative state of one duration series.
+type histogram struct {
+	// counts[i] is the number of observations <= buckets[i] (non-cumulative
+	// per bucket; cumulated at render time).
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// gaugeFunc is a gauge whose value is computed at scrape time.
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// Registry collects request metrics and renders them on demand. It is
+// safe for concurrent use.
+type Registry struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+	gauges    []gaugeFunc
+}
+
+// NewRegistry returns an empty Registry using DefaultBuckets.
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets:   DefaultBuckets,
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// GaugeFunc registers a gauge whose value is obtained by calling fn on
+// every scrape. fn must be safe for concurrent use.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges = append(r.gauges, gaugeFunc{name: name, help: help, fn: fn})
+}
+
+// Observe records one completed request.
+func (r *Registry) Observe(path string, status int, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests[requestKey{path: path, status: status}]++
+
+	h := r.durations[path]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		r.durations[path] = h
+	}
+	secs := d.Seconds()
+	for i, ub := range r.buckets {
+		if secs <= ub {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+// Middleware records every request passing through it. The path label is
+// the ServeMux pattern that matched the request (r.Pattern), which keeps
+// label cardinality bounded; unmatched requests are labelled "unmatched".
+//
+// r.Pattern is filled in by the ServeMux on the *http.Request it receives,
+// so no middleware between this one and the mux may replace the request
+// (e.g. via r.WithContext) or the label will always be "unmatched".
+func (r *Registry) Middleware() httpx.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			sw := httpx.NewStatusWriter(w)
+
+			next.ServeHTTP(sw, req)
+
+			path := req.Pattern
+			if path == "" {
+				path = "unmatched"
+			}
+			r.Observe(path, sw.Status(), time.Since(start))
+		})
+	}
+}
+
+// Handler returns a GET-only handler serving the exposition format.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !httpx.RequireMethod(w, req, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		w.WriteHeader(http.StatusOK)
+		_ = r.Write(w)
+	}
+}
+
+// Write renders all metrics in the Prometheus text exposition format.
+// Series are sorted so the output is stable between scrapes.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	reqs := make(map[requestKey]uint64, len(r.requests))
+	for k, v := range r.requests {
+		reqs[k] = v
+	}
+	paths := make([]string, 0, len(r.durations))
+	hists := make(map[string]histogram, len(r.durations))
+	for p, h := range r.durations {
+		paths = append(paths, p)
+		hists[p] = histogram{counts: append([]uint64(nil), h.counts...), sum: h.sum, count: h.count}
+	}
+	gauges := append([]gaugeFunc(nil), r.gauges...)
+	r.mu.Unlock()
+
+	reqKeys := make([]requestKey, 0, len(reqs))
+	for k := range reqs {
+		reqKeys = append(reqKeys, k)
+	}
+	sort.Slice(reqKeys, func(i, j int) bool {
+		if reqKeys[i].path != reqKeys[j].path {
+			return reqKeys[i].path < reqKeys[j].path
+		}
+		return reqKeys[i].status < reqKeys[j].status
+	})
+	sort.Strings(paths)
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "# HELP http_requests_total Total number of HTTP requests by path and status.")
+	fmt.Fprintln(bw, "# TYPE http_requests_total counter")
+	for _, k := range reqKeys {
+		fmt.Fprintf(bw, "http_requests_total{path=%s,status=\"%d\"} %d\n", quote(k.path), k.status, reqs[k])
+	}
+
+	fmt.Fprintln(bw, "# HELP http_request_duration_seconds HTTP request latency by path.")
+	fmt.Fprintln(bw, "# TYPE http_request_duration_seconds histogram")
+	for _, p := range paths {
+		h := hists[p]
+		var cum uint64
+		for i, ub := range r.buckets {
+			cum += h.counts[i]
+			fmt.Fprintf(bw, "http_request_duration_seconds_bucket{path=%s,le=\"%s\"} %d\n", quote(p), formatFloat(ub), cum)
+		}
+		fmt.Fprintf(bw, "http_request_duration_seconds_bucket{path=%s,le=\"+Inf\"} %d\n", quote(p), h.count)
+		fmt.Fprintf(bw, "http_request_duration_seconds_sum{path=%s} %s\n", quote(p), formatFloat(h.sum))
+		fmt.Fprintf(bw, "http_request_duration_seconds_count{path=%s} %d\n", quote(p), h.count)
+	}
+
+	for _, g := range gauges {
+		fmt.Fprintf(bw, "# HELP %s %s\n", g.name, g.help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", g.name)
+		fmt.Fprintf(bw, "%s %s\n", g.name, formatFloat(g.fn()))
+	}
+
+	return bw.Flush()
+}
+
+// labelEscaper escapes label values as required by the exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote returns v as a quoted, escaped label value.
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+// formatFloat renders f the way Prometheus expects (shortest form,
+// "+Inf"/"-Inf"/"NaN" for the special values).
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
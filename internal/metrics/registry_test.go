@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRegistry_Write checks the rendered exposition format for a small,
+// known set of observations.
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	r.GaugeFunc("probe_ready", "1 if ready.", func() float64 { return 1 })
+	r.Observe("/healthz", 200, 3*time.Millisecond)
+	r.Observe("/healthz", 200, 30*time.Millisecond)
+	r.Observe("/healthz", 503, time.Millisecond)
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE http_requests_total counter\n",
+		`http_requests_total{path="/healthz",status="200"} 2` + "\n",
+		`http_requests_total{path="/healthz",status="503"} 1` + "\n",
+		"# TYPE http_request_duration_seconds histogram\n",
+		`http_request_duration_seconds_bucket{path="/healthz",le="0.005"} 2` + "\n",
+		`http_request_duration_seconds_bucket{path="/healthz",le="0.025"} 2` + "\n",
+		`http_request_duration_seconds_bucket{path="/healthz",le="0.05"} 3` + "\n",
+		`http_request_duration_seconds_bucket{path="/healthz",le="+Inf"} 3` + "\n",
+		`http_request_duration_seconds_count{path="/healthz"} 3` + "\n",
+		"# TYPE probe_ready gauge\nprobe_ready 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n---\n%s", want, out)
+		}
+	}
+}
+
+// TestRegistry_Middleware verifies that the mux pattern is used as the
+// path label and that unmatched requests do not create per-URL series.
+func TestRegistry_Middleware(t *testing.T) {
+	r := NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := r.Middleware()(mux)
+
+	for _, p := range []string{"/items/1", "/items/2", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	var b strings.Builder
+	_ = r.Write(&b)
+	out := b.String()
+	if !strings.Contains(out, `http_requests_total{path="/items/{id}",status="418"} 2`) {
+		t.Errorf("missing pattern-labelled series:\n%s", out)
+	}
+	if !strings.Contains(out, `http_requests_total{path="unmatched",status="404"} 1`) {
+		t.Errorf("missing unmatched series:\n%s", out)
+	}
+}
+
+// TestQuote checks label value escaping.
+func TestQuote(t *testing.T) {
+	if got, want := quote("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != want {
+		t.Errorf("quote = %s, want %s", got, want)
+	}
+}
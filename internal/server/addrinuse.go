@@ -0,0 +1,12 @@
+//go:build !plan9
+
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// addrInUse reports whether err is a bind failure because the address is
+// already in use.
+func addrInUse(err error) bool { return errors.Is(err, syscall.EADDRINUSE) }
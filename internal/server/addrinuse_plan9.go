@@ -0,0 +1,10 @@
+package server
+
+import "strings"
+
+// addrInUse reports whether err is a bind failure because the address is
+// already in use. Plan 9 has no EADDRINUSE; announce fails with a plain
+// error string instead.
+func addrInUse(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "address in use")
+}
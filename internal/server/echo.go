@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"unicode/utf8"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// echoHandler builds a handler that accepts any method and reflects the
+// request back as JSON, which is useful to see what an ingress or proxy
+// actually forwards. The body is read with httpx.ReadBody, so bodies
+// above the MaxBody limit are answered with 413 "payload_too_large".
+// Non-UTF-8 bodies are returned base64-encoded with
+// "body_encoding": "base64".
+//
+//	{
+//	  "method":        "<method>",
+//	  "path":          "<path>",
+//	  "host":          "<Host header>",
+//	  "remote":        "<peer address>",
+//	  "query":         {"<name>": ["<value>", …]},
+//	  "headers":       {"<Name>": ["<value>", …]},
+//	  "body":          "<body>",
+//	  "body_encoding": "utf-8 | base64",
+//	  "body_bytes":    <int>,
+//	  "time":          "<RFC3339>"
+//	}
+func echoHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := httpx.ReadBody(w, r)
+		if !ok {
+			return
+		}
+
+		body, encoding := string(data), "utf-8"
+		if !utf8.Valid(data) {
+			body, encoding = base64.StdEncoding.EncodeToString(data), "base64"
+		}
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"method":        r.Method,
+			"path":          r.URL.Path,
+			"host":          r.Host,
+			"remote":        r.RemoteAddr,
+			"query":         r.URL.Query(),
+			"headers":       r.Header,
+			"body":          body,
+			"body_encoding": encoding,
+			"body_bytes":    len(data),
+			"time":          httpx.Timestamp(r),
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"bodsch.me/probe-service/pkg/flagx"
+)
+
+// unreadyGrace holds the liveness flag once readiness has been lost for
+// longer than grace (HEALTH_GRACE_AFTER_UNREADY), modelling a service
+// whose liveness fails only after it has been degraded for a while. Only
+// a loss counts: readiness that has not come up yet after start or a
+// reset never trips it. The hold is cleared like any other, with an
+// admin "up" or reset of health.
+type unreadyGrace struct {
+	grace  time.Duration
+	health *flagx.DelayedFlag
+	ready  *flagx.DelayedFlag
+}
+
+// newUnreadyGrace returns an unreadyGrace for grace, or nil if grace is
+// not positive.
+func newUnreadyGrace(grace time.Duration, health, ready *flagx.DelayedFlag) *unreadyGrace {
+	if grace <= 0 {
+		return nil
+	}
+	return &unreadyGrace{grace: grace, health: health, ready: ready}
+}
+
+// run polls the readiness flag until ctx is done, at a tenth of the grace
+// period (between 10ms and 1s), and holds health when a loss has lasted
+// the grace period. Every loss trips it at most once. It is called once,
+// from Run.
+func (g *unreadyGrace) run(ctx context.Context, log *slog.Logger) {
+	t := time.NewTicker(min(max(g.grace/10, 10*time.Millisecond), time.Second))
+	defer t.Stop()
+	wasReady := g.ready.Load()
+	var lost time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		ready := g.ready.Load()
+		switch {
+		case ready:
+			lost = time.Time{}
+		case wasReady:
+			lost = time.Now()
+		case !lost.IsZero() && time.Since(lost) >= g.grace:
+			g.health.Hold()
+			log.Warn("readiness lost for longer than HEALTH_GRACE_AFTER_UNREADY, holding liveness",
+				"unready_for", time.Since(lost).Round(time.Millisecond).String(),
+				"grace", g.grace.String(),
+			)
+			lost = time.Time{}
+		}
+		wasReady = ready
+	}
+}
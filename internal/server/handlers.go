@@ -3,10 +3,28 @@
 package server
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+	"time"
 
-	"bodsch.me/probe-service/internal/flagx"
-	"bodsch.me/probe-service/internal/httpx"
+	"bodsch.me/probe-service/internal/checks"
+	"bodsch.me/probe-service/internal/config"
+	"bodsch.me/probe-service/internal/metrics"
+	"bodsch.me/probe-service/pkg/flagx"
+	"bodsch.me/probe-service/pkg/httpx"
 )
 
 // probeLabels carries the two textual labels used in a probe handler's
@@ -18,16 +36,97 @@ type probeLabels struct {
 	down string
 }
 
-// livenessLabels are used by /healthz and /actuator/health/liveness.
+// livenessLabels are used by /healthz, /livez and /actuator/health/liveness.
 var livenessLabels = probeLabels{up: "ok", down: "unhealthy"}
 
 // readinessLabels are used by /readyz and /actuator/health/readiness.
 var readinessLabels = probeLabels{up: "ready", down: "not-ready"}
 
-// probeHandler builds a GET-only handler that reports the state of the
-// supplied DelayedFlag. When the flag is true the handler returns 200
-// and labels.up; when it is false it returns 503, labels.down, and the
-// remaining time until the flag would flip.
+// drainingLabel replaces readinessLabels.down once graceful shutdown has
+// begun, to tell shutting down apart from starting up.
+const drainingLabel = "draining"
+
+// startupLabels are used by /startupz.
+var startupLabels = probeLabels{up: "started", down: "starting"}
+
+// probe describes one probe endpoint: the flag it reports, how its
+// states are labelled, and any additional conditions that must hold for
+// the probe to be up.
+type probe struct {
+	flag    *flagx.DelayedFlag
+	labels  probeLabels
+	service string
+	version string
+	// started is the process start time, reported as "started_at" and
+	// "uptime_ms".
+	started time.Time
+	// dependency, when non-nil, must also succeed for the probe to be up.
+	// Its result is reported under "dependency" in every response.
+	dependency *checks.Cached
+	// dependencyURL is reported alongside the dependency result, with
+	// any password masked.
+	dependencyURL string
+	// warmup, when non-nil, must have completed for the probe to be up.
+	// Its state is reported under "warmup".
+	warmup *warmup
+	// ramp, when non-nil, lets a growing share of requests pass during
+	// the second half of the flag's delay (READY_RAMP).
+	ramp *ramp
+	// checks, when non-nil, must all succeed for the probe to be up.
+	// Their results are reported under "checks", keyed by name.
+	checks *checks.Registry
+	// draining, when non-nil and set, fails the probe with the status
+	// label "draining" (graceful shutdown in progress).
+	draining *atomic.Bool
+	// maintenance, when non-nil and set, fails the probe with the status
+	// label "maintenance" (see maintenanceGate).
+	maintenance *atomic.Bool
+	// heap, when non-nil, must be within its limit for the probe to be
+	// up. Its figures are reported under "heap" while it is not.
+	heap *heapGuard
+	// disk, when non-nil, must report enough free space for the probe to
+	// be up. Its state is reported under "disk".
+	disk *diskCheck
+	// file, when non-nil, must exist (and be non-empty if required) for
+	// the probe to be up. Its state is reported under "file".
+	file *fileCheck
+	// command, when non-nil, must have exited 0 on its last run for the
+	// probe to be up. Its result is reported under "command".
+	command *healthCommand
+	// passes, when non-nil, counts the 200 responses of this probe
+	// (liveness, for READY_AFTER_HEALTH_CHECKS).
+	passes *healthPasses
+	// needPasses, when non-nil, must have counted enough liveness passes
+	// for the probe to be up. Its state is reported under "health_checks".
+	needPasses *healthPasses
+	// failureRate is the probability that the probe reports down although
+	// everything else is up; rand returns values in [0,1) and defaults to
+	// math/rand/v2.Float64.
+	failureRate float64
+	rand        func() float64
+	// text replaces the JSON envelope with the bare status label as
+	// text/plain (PROBE_RESPONSE_FORMAT=text). Status codes are the same.
+	text bool
+	// extra holds PROBE_EXTRA_JSON fields added to the JSON envelope.
+	// Keys of the envelope's own fields must have been removed (see
+	// probeExtra).
+	extra map[string]any
+	// padding is added as "padding" to the JSON envelope to inflate the
+	// response (PROBE_PAYLOAD_BYTES); see probePadding.
+	padding string
+	// downBody, when its Content is set, replaces the body of every 503
+	// response (PROBE_UNHEALTHY_BODY, PROBE_NOTREADY_BODY).
+	downBody config.ProbeBody
+	// metric lets clients that prefer text/plain over JSON in Accept
+	// receive a Prometheus "up 1" / "up 0" gauge instead (liveness only).
+	metric bool
+}
+
+// probeHandler builds a GET and HEAD handler that reports the state of the
+// probe's DelayedFlag. When the flag is true (and the dependency, if any,
+// is healthy) the handler returns 200 and labels.up; otherwise it returns
+// 503, labels.down, and, while the flag is still false, the remaining time
+// until it would flip.
 //
 // All probe responses share the same JSON envelope so that monitoring
 // systems can parse them uniformly:
@@ -36,70 +135,774 @@ var readinessLabels = probeLabels{up: "ready", down: "not-ready"}
 //	  "status":         "<labels.up | labels.down>",
 //	  "service":        "<service name>",
 //	  "version":        "<service version>",
-//	  "retry_after_ms": <int, only present when not-up>,
-//	  "time":           "<RFC3339>"
+//	  "started_at":     "<RFC3339 process start time>",
+//	  "uptime_ms":      <int, milliseconds since started_at>,
+//	  "retry_after_ms": <int, only present while the flag is false>,
+//	  "dependency":     {<only present when a dependency is configured>},
+//	  "warmup":         {<only present when a warmup is configured>},
+//	  "checks":         {<name>: {...}, only present when checks are registered},
+//	  "heap":           {<only present while the heap limit is exceeded>},
+//	  "disk":           {<only present when a disk check is configured>},
+//	  "file":           {<only present when a ready file is configured>},
+//	  "command":        {<only present when a check command is configured>},
+//	  "health_checks":  {<only present with READY_AFTER_HEALTH_CHECKS>},
+//	  "cycle":          {<only present when the flag has a TTL>},
+//	  "time":           "<RFC3339>",
+//	  "padding":        "<base64 filler, only present with p.padding>",
+//	  <p.extra fields>
 //	}
-func probeHandler(flag *flagx.DelayedFlag, labels probeLabels, service, version string) http.HandlerFunc {
+//
+// While the flag is false and its delay is still running, the 503 also
+// carries a Retry-After header with the remaining time in whole seconds,
+// rounded up. With p.ramp, requests late in the delay may already pass.
+// With p.text the body is just the status label as text/plain. With
+// p.metric a client whose Accept header prefers text/plain over
+// application/json gets the state as a Prometheus gauge ("up 1" or
+// "up 0") with the same status code; "*/*" keeps the default format. A
+// p.downBody replaces the body of 503 responses, but not the gauge, and
+// is sent as configured even with JSON_CASE=camel. HEAD gets the same
+// status and headers without a body.
+func probeHandler(p probe) http.HandlerFunc {
+	if p.rand == nil {
+		p.rand = rand.Float64
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			httpx.WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+		if !httpx.RequireMethod(w, r, http.MethodGet, http.MethodHead) {
 			return
 		}
-		if !flag.Load() {
-			httpx.WriteJSON(w, http.StatusServiceUnavailable, map[string]any{
-				"status":         labels.down,
-				"service":        service,
-				"version":        version,
-				"retry_after_ms": flag.Remaining().Milliseconds(),
-				"time":           httpx.NowRFC3339(),
-			})
+		if r.Method == http.MethodHead {
+			w = httpx.DiscardBody(w)
+		}
+		if p.metric {
+			w.Header().Add("Vary", "Accept")
+		}
+
+		tf := httpx.TimeFormatFromContext(r.Context())
+		body := make(map[string]any, len(p.extra)+8)
+		maps.Copy(body, p.extra)
+		body["service"] = p.service
+		body["version"] = p.version
+		body["started_at"] = tf.Format(p.started)
+		body["uptime_ms"] = time.Since(p.started).Milliseconds()
+		body["time"] = tf.Format(time.Now())
+		if p.padding != "" {
+			body["padding"] = p.padding
+		}
+		up := p.flag.Load()
+		if !up && p.ramp != nil {
+			up = p.ramp.pass(elapsed(p.flag))
+		}
+		if !up {
+			remaining := p.flag.Remaining()
+			body["retry_after_ms"] = remaining.Milliseconds()
+			if remaining > 0 {
+				secs := int64(math.Ceil(remaining.Seconds()))
+				w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+			}
+		}
+		if ttl := p.flag.TTL(); ttl > 0 {
+			body["cycle"] = map[string]any{
+				"ttl_ms":        ttl.Milliseconds(),
+				"count":         p.flag.Cycles(),
+				"expires_in_ms": p.flag.TTLRemaining().Milliseconds(),
+			}
+		}
+		if p.dependency != nil {
+			res := p.dependency.Result()
+			body["dependency"] = dependencyBody(p.dependencyURL, res, tf)
+			up = up && res.OK()
+		}
+		if p.warmup != nil {
+			done, wb := p.warmup.status()
+			body["warmup"] = wb
+			up = up && done
+		}
+		if p.checks != nil && p.checks.Len() > 0 {
+			ok, reports := p.checks.Run()
+			m := make(map[string]any, len(reports))
+			for _, rep := range reports {
+				m[rep.Name] = checkBody(rep, tf)
+			}
+			body["checks"] = m
+			up = up && ok
+		}
+
+		if p.heap != nil {
+			if ok, hb := p.heap.status(); !ok {
+				body["heap"] = hb
+				up = false
+			}
+		}
+		if p.disk != nil {
+			ok, db := p.disk.status()
+			body["disk"] = db
+			up = up && ok
+		}
+		if p.file != nil {
+			ok, fb := p.file.status()
+			body["file"] = fb
+			up = up && ok
+		}
+		if p.command != nil {
+			ok, cb := p.command.status(tf)
+			body["command"] = cb
+			up = up && ok
+		}
+		if p.needPasses != nil {
+			ok, hb := p.needPasses.status()
+			body["health_checks"] = hb
+			up = up && ok
+		}
+
+		if up && p.failureRate > 0 && p.rand() < p.failureRate {
+			up = false
+		}
+
+		status, label := http.StatusOK, p.labels.up
+		if !up {
+			status, label = http.StatusServiceUnavailable, p.labels.down
+		}
+		if p.draining != nil && p.draining.Load() {
+			status, label = http.StatusServiceUnavailable, drainingLabel
+		}
+		if p.maintenance != nil && p.maintenance.Load() {
+			up = false
+			status, label = http.StatusServiceUnavailable, maintenanceLabel
+		}
+		if p.passes != nil && status == http.StatusOK {
+			p.passes.add()
+		}
+		if p.metric && httpx.Negotiate(r, "application/json", "text/plain") == "text/plain" {
+			value := "0"
+			if up {
+				value = "1"
+			}
+			w.Header().Set("Content-Type", metrics.ContentType)
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, "# TYPE up gauge\nup "+value+"\n")
 			return
 		}
-		httpx.WriteJSON(w, http.StatusOK, map[string]any{
-			"status":  labels.up,
-			"service": service,
-			"version": version,
-			"time":    httpx.NowRFC3339(),
+		if status != http.StatusOK && p.downBody.Content != "" {
+			ctype := "text/plain; charset=utf-8"
+			if p.downBody.JSON {
+				ctype = "application/json; charset=utf-8"
+			}
+			httpx.KeepJSONKeys(w)
+			w.Header().Set("Content-Type", ctype)
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, p.downBody.Content)
+			return
+		}
+		if p.text {
+			httpx.WriteText(w, status, label)
+			return
+		}
+		body["status"] = label
+		httpx.WriteJSON(w, status, body)
+	}
+}
+
+// probeFields are the keys of the probe JSON envelope.
+var probeFields = []string{
+	"status", "service", "version", "started_at", "uptime_ms",
+	"retry_after_ms", "dependency", "warmup", "checks", "heap", "disk",
+	"file", "command", "health_checks", "cycle", "time", "padding",
+}
+
+// probeExtra returns cfg.ProbeExtra without the keys of the probe
+// envelope, so that custom fields never replace or fake core fields.
+func probeExtra(cfg config.Config) map[string]any {
+	if len(cfg.ProbeExtra) == 0 {
+		return nil
+	}
+	extra := maps.Clone(cfg.ProbeExtra)
+	for _, k := range probeFields {
+		delete(extra, k)
+	}
+	return extra
+}
+
+// probePadding returns n characters of base64-encoded random bytes, or ""
+// for n <= 0. The filler is generated once per handler; random content
+// keeps ENABLE_COMPRESSION from shrinking it away.
+func probePadding(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	b := make([]byte, base64.StdEncoding.DecodedLen(n)+3)
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+	return base64.StdEncoding.EncodeToString(b)[:n]
+}
+
+// diskCheck fails a probe while the file system containing path has less
+// than min bytes available (MIN_FREE_DISK_BYTES). Statfs is cheap, so it
+// runs on every request.
+type diskCheck struct {
+	path string
+	min  int64
+}
+
+// status checks the free space and renders it for probe responses.
+func (d *diskCheck) status() (ok bool, body map[string]any) {
+	free, err := checks.DiskFree(d.path)
+	ok = err == nil && free >= uint64(d.min)
+	body = map[string]any{
+		"path":           d.path,
+		"ok":             ok,
+		"free_bytes":     free,
+		"min_free_bytes": d.min,
+	}
+	if err != nil {
+		body["error"] = err.Error()
+	}
+	return ok, body
+}
+
+// fileCheck fails a probe until the file at path exists and, with
+// nonEmpty, has a size above zero (READY_FILE). A stat is cheap, so it
+// runs on every request and a freshly written file is seen immediately.
+type fileCheck struct {
+	path     string
+	nonEmpty bool
+}
+
+// status stats the file and renders the result for probe responses.
+func (f *fileCheck) status() (ok bool, body map[string]any) {
+	fi, err := os.Stat(f.path)
+	present := err == nil
+	ok = present && (!f.nonEmpty || fi.Size() > 0)
+	body = map[string]any{
+		"path":    f.path,
+		"ok":      ok,
+		"present": present,
+	}
+	if present {
+		body["size_bytes"] = fi.Size()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		body["error"] = err.Error()
+	}
+	return ok, body
+}
+
+// healthPasses counts successful liveness responses, so that readiness
+// can wait for a number of them (READY_AFTER_HEALTH_CHECKS). The count
+// covers the process lifetime; admin resets do not clear it.
+type healthPasses struct {
+	need int64
+	n    atomic.Int64
+}
+
+// newHealthPasses returns a healthPasses waiting for n passes, or nil if
+// n is not positive.
+func newHealthPasses(n int) *healthPasses {
+	if n <= 0 {
+		return nil
+	}
+	return &healthPasses{need: int64(n)}
+}
+
+// add records one successful liveness response.
+func (h *healthPasses) add() { h.n.Add(1) }
+
+// status reports whether enough passes were counted, rendered for probe
+// responses.
+func (h *healthPasses) status() (ok bool, body map[string]any) {
+	n := h.n.Load()
+	ok = n >= h.need
+	return ok, map[string]any{"ok": ok, "passed": n, "required": h.need}
+}
+
+// dependencyBody renders a dependency check result for probe responses.
+func dependencyBody(url string, res checks.Result, tf httpx.TimeFormat) map[string]any {
+	m := map[string]any{
+		"url":        url,
+		"ok":         res.OK(),
+		"latency_ms": res.Latency.Milliseconds(),
+		"checked_at": tf.Format(res.CheckedAt),
+	}
+	if res.Err != nil {
+		m["error"] = res.Err.Error()
+	}
+	return m
+}
+
+// checkBody renders a named check report for probe responses.
+func checkBody(rep checks.Report, tf httpx.TimeFormat) map[string]any {
+	m := map[string]any{
+		"type":       rep.Kind,
+		"target":     rep.Target,
+		"ok":         rep.OK(),
+		"latency_ms": rep.Latency.Milliseconds(),
+		"checked_at": tf.Format(rep.CheckedAt),
+	}
+	if rep.Err != nil {
+		m["error"] = rep.Err.Error()
+	}
+	return m
+}
+
+// livenessHandler is the handler shared by all liveness routes. With
+// cfg.HealthFailureRate it fails that fraction of requests at random, and
+// with cfg.MinFreeDiskBytes while disk space at cfg.DiskCheckPath is low.
+// hc, if non-nil, must have exited 0 on its last run (HEALTH_CHECK_CMD).
+// Every 200 answer is counted in passes, if non-nil, for readiness.
+// Liveness also answers "Accept: text/plain" with an "up" gauge.
+func livenessHandler(cfg config.Config, health *flagx.DelayedFlag, hc *healthCommand, passes *healthPasses, maintenance *atomic.Bool, started time.Time) http.HandlerFunc {
+	p := probe{
+		flag:        health,
+		labels:      livenessLabels,
+		service:     cfg.ServiceName,
+		version:     cfg.Version,
+		started:     started,
+		failureRate: cfg.HealthFailureRate,
+		text:        cfg.ProbeResponseFormat == "text",
+		extra:       probeExtra(cfg),
+		padding:     probePadding(cfg.ProbePayloadBytes),
+		metric:      true,
+		command:     hc,
+		passes:      passes,
+		maintenance: maintenance,
+		downBody:    cfg.ProbeUnhealthyBody,
+	}
+	if cfg.MinFreeDiskBytes > 0 {
+		p.disk = &diskCheck{path: cfg.DiskCheckPath, min: cfg.MinFreeDiskBytes}
+	}
+	return probeHandler(p)
+}
+
+// readinessHandler is the handler shared by all readiness routes. If
+// cfg.ReadyDependencyURL is set, readiness additionally requires a 2xx
+// answer from that URL (cached for cfg.ReadyDependencyTTL), and every
+// entry in cfg.ReadyChecks must pass as well. wu, if non-nil, must have
+// completed successfully, and hg, if non-nil, must report the heap within
+// MAX_HEAP_BYTES. cfg.ReadyFile, if set, must exist, and passes, if
+// non-nil, must have counted enough liveness passes. Once draining is
+// set, readiness answers 503 "draining". cfg.ReadyRamp turns the flip at
+// the end of the delay into a slow start.
+func readinessHandler(cfg config.Config, ready *flagx.DelayedFlag, wu *warmup, hg *heapGuard, passes *healthPasses, draining, maintenance *atomic.Bool, started time.Time) http.HandlerFunc {
+	p := probe{
+		flag:        ready,
+		labels:      readinessLabels,
+		service:     cfg.ServiceName,
+		version:     cfg.Version,
+		started:     started,
+		warmup:      wu,
+		heap:        hg,
+		needPasses:  passes,
+		draining:    draining,
+		maintenance: maintenance,
+		downBody:    cfg.ProbeNotReadyBody,
+		text:        cfg.ProbeResponseFormat == "text",
+		extra:       probeExtra(cfg),
+		padding:     probePadding(cfg.ProbePayloadBytes),
+	}
+	if cfg.ReadyRamp {
+		p.ramp = &ramp{}
+	}
+	if cfg.ReadyFile != "" {
+		p.file = &fileCheck{path: cfg.ReadyFile, nonEmpty: cfg.ReadyFileNonEmpty}
+	}
+	if cfg.ReadyDependencyURL != "" {
+		p.dependency = checks.NewCached(
+			checks.HTTPGet(nil, cfg.ReadyDependencyURL),
+			cfg.ReadyDependencyTTL,
+			cfg.ReadyDependencyTimeout,
+		)
+		p.dependencyURL = redactURL(cfg.ReadyDependencyURL)
+	}
+	p.checks = checks.NewRegistry()
+	for _, c := range cfg.ReadyChecks {
+		fn, target := checks.TCPDial(c.Target), c.Target
+		if c.Kind == "http" {
+			fn = checks.HTTPGet(nil, c.Target)
+			if u, err := url.Parse(c.Target); err == nil {
+				target = u.Redacted()
+			}
+		}
+		p.checks.Register(checks.Check{
+			Name:   c.Name,
+			Kind:   c.Kind,
+			Target: target,
+			Cached: checks.NewCached(fn, cfg.ReadyDependencyTTL, cfg.ReadyDependencyTimeout),
 		})
 	}
+	return probeHandler(p)
+}
+
+// startupHandler serves /startupz. Its flag has no TTL and no admin
+// route resets it, so once it has flipped it stays up for the lifetime of
+// the process, independent of liveness and readiness.
+func startupHandler(cfg config.Config, startup *flagx.DelayedFlag, maintenance *atomic.Bool, started time.Time) http.HandlerFunc {
+	return probeHandler(probe{
+		flag:        startup,
+		maintenance: maintenance,
+		labels:      startupLabels,
+		service:     cfg.ServiceName,
+		version:     cfg.Version,
+		started:     started,
+		text:        cfg.ProbeResponseFormat == "text",
+		extra:       probeExtra(cfg),
+		padding:     probePadding(cfg.ProbePayloadBytes),
+	})
 }
 
-// resetTarget pairs a DelayedFlag with the JSON key under which its
-// remaining delay should be reported by the reset handler.
-type resetTarget struct {
+// flagTarget pairs a DelayedFlag with the JSON keys under which its
+// state should be reported by the admin handlers.
+type flagTarget struct {
 	// stateKey is the JSON field name for the boolean state, e.g. "health".
 	stateKey string
 	// remainingKey is the JSON field name for the millisecond countdown,
 	// e.g. "health_in_ms".
 	remainingKey string
-	// flag is the DelayedFlag to be reset by this handler.
+	// delayKey is the JSON field name for the flag's configured delay,
+	// e.g. "health_delay".
+	delayKey string
+	// effectiveKey is the JSON field name for the delay applied by the
+	// latest arm, including STARTUP_DELAY_JITTER, e.g.
+	// "health_effective_delay".
+	effectiveKey string
+	// heldKey is the JSON field name reporting whether the flag is pinned
+	// to false by Hold, e.g. "health_held".
+	heldKey string
+	// flag is the DelayedFlag acted upon by the handler.
 	flag *flagx.DelayedFlag
 }
 
-// resetHandler builds a POST-only handler that calls Reset() on every
-// target and returns a JSON description of the new state.
+// resetHandler builds a POST-only handler that calls Release() on every
+// target (which clears a Hold and re-arms the delay, with jitter if
+// configured) and returns a JSON description of the new state.
+//
+// An optional JSON body {"delay": "<Go duration>"} overrides the
+// configured delay for this reset only (see DelayedFlag.ReleaseWith). An
+// undecodable body is answered with 400 "invalid_body", an unparseable
+// or negative delay with 400 "invalid_delay". A reset that throttle
+// (which may be nil) refuses is answered with 429 "too_frequent" and a
+// Retry-After header, without re-arming any flag.
 //
-// The response always contains a "delay" field (the configured delay as
-// a Go duration string), a "time" field, and for each target a state
-// field set to false and a *_in_ms field with the remaining time.
-func resetHandler(delayStr string, targets ...resetTarget) http.HandlerFunc {
+// The response always contains a "time" field, and for each target a
+// state field set to false, a *_delay field with the delay applied as a
+// Go duration string, and a *_in_ms field with the remaining time.
+func resetHandler(throttle *resetThrottle, targets ...flagTarget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodPost) || !httpx.RequireJSON(w, r) {
+			return
+		}
+		override, ok := resetDelay(w, r)
+		if !ok {
+			return
+		}
+		if wait := throttle.take(time.Now()); wait > 0 {
+			secs := int64(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+			httpx.WriteError(w, r, http.StatusTooManyRequests, "too_frequent")
+			return
+		}
+		body := map[string]any{
+			"time": httpx.Timestamp(r),
+		}
+		for _, t := range targets {
+			if override != nil {
+				t.flag.ReleaseWith(*override)
+			} else {
+				t.flag.Release()
+			}
+			body[t.stateKey] = false
+			body[t.delayKey] = t.flag.EffectiveDelay().String()
+			body[t.remainingKey] = t.flag.Remaining().Milliseconds()
+		}
+		httpx.WriteJSON(w, http.StatusOK, body)
+	}
+}
+
+// resetThrottle enforces a minimum interval between admin resets
+// (RESET_MIN_INTERVAL), shared by all reset routes, so that a client
+// hammering them cannot churn the flag timers. A nil *resetThrottle
+// allows every reset.
+type resetThrottle struct {
+	min time.Duration
+	// last is the UnixNano time of the last accepted reset.
+	last atomic.Int64
+}
+
+// newResetThrottle returns a resetThrottle for min, or nil if min is not
+// positive.
+func newResetThrottle(min time.Duration) *resetThrottle {
+	if min <= 0 {
+		return nil
+	}
+	return &resetThrottle{min: min}
+}
+
+// take records a reset at now and returns 0 if the previous accepted
+// reset is at least min ago; otherwise it returns the time left and
+// records nothing.
+func (t *resetThrottle) take(now time.Time) time.Duration {
+	if t == nil {
+		return 0
+	}
+	for {
+		last := t.last.Load()
+		if wait := time.Duration(last + int64(t.min) - now.UnixNano()); last != 0 && wait > 0 {
+			return wait
+		}
+		if t.last.CompareAndSwap(last, now.UnixNano()) {
+			return 0
+		}
+	}
+}
+
+// resetDelay reads the optional reset body described on resetHandler. It
+// returns nil when no delay was given. On invalid input it writes the 4xx
+// response itself and returns ok=false.
+func resetDelay(w http.ResponseWriter, r *http.Request) (delay *time.Duration, ok bool) {
+	var req struct {
+		Delay *string `json:"delay"`
+	}
+	if err := decodeJSON(r, &req); errors.Is(err, io.EOF) {
+		return nil, true
+	} else if err != nil {
+		writeDecodeError(w, r, err)
+		return nil, false
+	}
+	if req.Delay == nil {
+		return nil, true
+	}
+	d, err := time.ParseDuration(*req.Delay)
+	if err != nil || d < 0 {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid_delay")
+		return nil, false
+	}
+	return &d, true
+}
+
+// bodyError is returned by decodeJSON for a body that is not exactly one
+// JSON value matching dst. Handlers answer it with 400 "invalid_body".
+type bodyError struct{ err error }
+
+func (e *bodyError) Error() string { return "invalid body: " + e.err.Error() }
+func (e *bodyError) Unwrap() error { return e.err }
+
+// decodeJSON decodes the request body into dst, rejecting fields that dst
+// does not declare and any data after the first value, so that typos in
+// admin payloads fail loudly instead of being ignored. It returns io.EOF
+// for an empty (or whitespace-only) body, the *http.MaxBytesError of the
+// MaxBody middleware if the body is too large, and a *bodyError otherwise.
+func decodeJSON(r *http.Request, dst any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.Is(err, io.EOF) || errors.As(err, &tooLarge) {
+			return err
+		}
+		return &bodyError{err}
+	}
+	var rest json.RawMessage
+	if err := dec.Decode(&rest); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return &bodyError{errors.New("unexpected data after the JSON value")}
+	}
+	return nil
+}
+
+// writeDecodeError answers a decodeJSON error: 413 "payload_too_large"
+// for an oversized body, 400 "invalid_body" for anything else.
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		httpx.WriteError(w, r, http.StatusRequestEntityTooLarge, "payload_too_large")
+		return
+	}
+	httpx.WriteError(w, r, http.StatusBadRequest, "invalid_body")
+}
+
+// upHandler builds a POST-only handler that forces every target to true
+// immediately, cancelling any pending delay. The response reports each
+// target's state (true) and a *_in_ms field of 0.
+func upHandler(targets ...flagTarget) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			httpx.WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+		if !httpx.RequireMethod(w, r, http.MethodPost) || !httpx.RequireJSON(w, r) {
 			return
 		}
+		body := map[string]any{
+			"time": httpx.Timestamp(r),
+		}
 		for _, t := range targets {
-			t.flag.Reset()
+			t.flag.Set(true)
+			body[t.stateKey] = true
+			body[t.remainingKey] = t.flag.Remaining().Milliseconds()
 		}
+		httpx.WriteJSON(w, http.StatusOK, body)
+	}
+}
 
+// downHandler builds a POST-only handler that pins every target to false
+// via Hold. The flag does not recover on its own; it stays down until the
+// next reset or up call. The response reports each target's state
+// (false), *_held (true) and a *_in_ms field of 0.
+func downHandler(targets ...flagTarget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodPost) || !httpx.RequireJSON(w, r) {
+			return
+		}
 		body := map[string]any{
-			"delay": delayStr,
-			"time":  httpx.NowRFC3339(),
+			"time": httpx.Timestamp(r),
 		}
 		for _, t := range targets {
+			t.flag.Hold()
 			body[t.stateKey] = false
+			body[t.heldKey] = true
 			body[t.remainingKey] = t.flag.Remaining().Milliseconds()
 		}
 		httpx.WriteJSON(w, http.StatusOK, body)
 	}
 }
+
+// shutdownHandler builds a POST-only handler that answers 200 and then
+// calls shutdown, which starts the same graceful shutdown as SIGTERM. The
+// response completes before the server stops, because Shutdown waits for
+// in-flight requests.
+func shutdownHandler(shutdown func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodPost) || !httpx.RequireJSON(w, r) {
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"status": "shutting-down",
+			"time":   httpx.Timestamp(r),
+		})
+		shutdown()
+	}
+}
+
+// statusHandler builds a GET-only handler that reports the state of every
+// target in a single 200 response, regardless of whether the flags are
+// true. For each target it includes the state, *_in_ms (remaining delay),
+// *_delay (configured delay), *_effective_delay (delay applied by the
+// latest arm, including jitter) and *_held fields.
+func statusHandler(targets ...flagTarget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet) {
+			return
+		}
+		body := map[string]any{
+			"time": httpx.Timestamp(r),
+		}
+		for _, t := range targets {
+			body[t.stateKey] = t.flag.Load()
+			body[t.remainingKey] = t.flag.Remaining().Milliseconds()
+			body[t.delayKey] = t.flag.Delay().String()
+			body[t.effectiveKey] = t.flag.EffectiveDelay().String()
+			body[t.heldKey] = t.flag.Held()
+		}
+		httpx.WriteJSON(w, http.StatusOK, body)
+	}
+}
+
+// statusCodeHandler builds a GET-only handler for /status/{code} that
+// answers with the requested status code, for exercising client error
+// handling. Codes outside 100-599 are rejected with 400 "invalid_status".
+// Bodies are omitted by net/http for codes that do not allow one (1xx,
+// 204, 304); a 1xx code is sent as an interim response followed by 200.
+//
+//	{
+//	  "status": <code>,
+//	  "text":   "<http.StatusText(code)>",
+//	  "time":   "<RFC3339>"
+//	}
+func statusCodeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet) {
+			return
+		}
+		code, err := strconv.Atoi(r.PathValue("code"))
+		if err != nil || code < 100 || code > 599 {
+			httpx.WriteError(w, r, http.StatusBadRequest, "invalid_status")
+			return
+		}
+		httpx.WriteJSON(w, code, map[string]any{
+			"status": code,
+			"text":   http.StatusText(code),
+			"time":   httpx.Timestamp(r),
+		})
+	}
+}
+
+// buildMetadata holds the VCS and toolchain information embedded into
+// the binary by the Go linker.
+type buildMetadata struct {
+	goVersion   string
+	vcsRevision string
+	vcsModified bool
+	buildTime   string
+}
+
+// readBuildMetadata extracts buildMetadata from runtime/debug.ReadBuildInfo.
+// Fields that are not available (e.g. for binaries built with
+// -buildvcs=false or via `go run`) are left empty; goVersion always falls
+// back to runtime.Version().
+func readBuildMetadata() buildMetadata {
+	m := buildMetadata{goVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return m
+	}
+	if bi.GoVersion != "" {
+		m.goVersion = bi.GoVersion
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			m.vcsRevision = s.Value
+		case "vcs.time":
+			m.buildTime = s.Value
+		case "vcs.modified":
+			m.vcsModified = s.Value == "true"
+		}
+	}
+	return m
+}
+
+// versionHandler builds a GET-only handler that reports build metadata.
+// Unlike the probe handlers it always returns 200, independent of the
+// liveness and readiness state. The commit and date injected via -ldflags
+// (cfg.BuildCommit, cfg.BuildDate) take precedence over the VCS
+// information embedded by the toolchain.
+//
+//	{
+//	  "service":      "<service name>",
+//	  "version":      "<service version>",
+//	  "go_version":   "<toolchain, e.g. go1.25.1>",
+//	  "vcs_revision": "<commit hash or empty>",
+//	  "vcs_modified": <bool>,
+//	  "build_time":   "<build date or RFC3339 commit time, or empty>",
+//	  "time":         "<RFC3339>"
+//	}
+func versionHandler(cfg config.Config) http.HandlerFunc {
+	meta := readBuildMetadata()
+	if cfg.BuildCommit != "" {
+		meta.vcsRevision = cfg.BuildCommit
+	}
+	if cfg.BuildDate != "" {
+		meta.buildTime = cfg.BuildDate
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet) {
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"service":      cfg.ServiceName,
+			"version":      cfg.Version,
+			"go_version":   meta.goVersion,
+			"vcs_revision": meta.vcsRevision,
+			"vcs_modified": meta.vcsModified,
+			"build_time":   meta.buildTime,
+			"time":         httpx.Timestamp(r),
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// maxCommandStderr bounds how much of a failing command's stderr is
+// logged.
+const maxCommandStderr = 4 << 10
+
+// commandWaitDelay bounds the wait for stderr to close after a timed-out
+// command was killed: children of the shell may still hold it open.
+const commandWaitDelay = 100 * time.Millisecond
+
+// healthCommand fails liveness while a shell command exits non-zero
+// (HEALTH_CHECK_CMD), like a Kubernetes exec probe. The command runs in
+// the background every interval; probe requests only read the last
+// result and never wait for it.
+type healthCommand struct {
+	cmd      string
+	interval time.Duration
+	timeout  time.Duration
+
+	mu        sync.Mutex
+	ran       bool
+	exitCode  int
+	err       error
+	latency   time.Duration
+	checkedAt time.Time
+}
+
+// commandName returns the executable of a shell command line, skipping
+// leading VAR=value assignments, for reporting the command on public
+// endpoints: its arguments may carry tokens or passwords.
+func commandName(cmd string) string {
+	for _, f := range strings.Fields(cmd) {
+		if !strings.Contains(f, "=") {
+			return f
+		}
+	}
+	return ""
+}
+
+// cappedBuffer keeps the first max bytes written to it and silently
+// drops the rest, so a chatty command cannot grow it without bound.
+type cappedBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// newHealthCommand returns a healthCommand for cmd, or nil if cmd is
+// empty.
+func newHealthCommand(cmd string, interval, timeout time.Duration) *healthCommand {
+	if cmd == "" {
+		return nil
+	}
+	return &healthCommand{cmd: cmd, interval: interval, timeout: timeout}
+}
+
+// exec runs the command once with "sh -c" and records its outcome. A
+// command that cannot be started or exceeds the timeout counts as failed
+// with exit code -1. Up to maxCommandStderr bytes of stderr are logged
+// when the command fails.
+func (h *healthCommand) exec(ctx context.Context, log *slog.Logger) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	stderr := cappedBuffer{max: maxCommandStderr}
+	c := exec.CommandContext(ctx, "sh", "-c", h.cmd)
+	c.Stderr = &stderr
+	c.WaitDelay = commandWaitDelay
+	start := time.Now()
+	err := c.Run()
+	latency := time.Since(start)
+
+	code := 0
+	if err != nil {
+		code = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			code = exitErr.ExitCode()
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		log.Warn("health check command failed",
+			"cmd", h.cmd,
+			"exit_code", code,
+			"err", err,
+			"stderr", strings.TrimSpace(stderr.buf.String()),
+		)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ran = true
+	h.exitCode = code
+	h.err = err
+	h.latency = latency
+	h.checkedAt = time.Now()
+}
+
+// run executes the command immediately and then every interval until ctx
+// is done. It is called once, from Run.
+func (h *healthCommand) run(ctx context.Context, log *slog.Logger) {
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+	for {
+		h.exec(ctx, log)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// status reports whether the last run exited 0, together with its result
+// for probe responses. Until the first run has finished the command
+// counts as failed and is reported with "state": "pending". Only the
+// executable of the command is reported (see commandName).
+//
+//	{"cmd": "<executable>", "ok": <bool>, "exit_code": <int>,
+//	 "latency_ms": <int>, "checked_at": "<RFC3339>", "error": "<only on failure>"}
+func (h *healthCommand) status(tf httpx.TimeFormat) (ok bool, body map[string]any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.ran {
+		return false, map[string]any{"cmd": commandName(h.cmd), "ok": false, "state": "pending"}
+	}
+	ok = h.err == nil
+	body = map[string]any{
+		"cmd":        commandName(h.cmd),
+		"ok":         ok,
+		"exit_code":  h.exitCode,
+		"latency_ms": h.latency.Milliseconds(),
+		"checked_at": tf.Format(h.checkedAt),
+	}
+	if h.err != nil {
+		body["error"] = h.err.Error()
+	}
+	return ok, body
+}
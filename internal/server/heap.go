@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// heapPollInterval is how often heapGuard samples the heap size.
+const heapPollInterval = time.Second
+
+// heapGuard fails readiness while the heap exceeds a limit
+// (MAX_HEAP_BYTES), simulating load shedding under memory pressure. The
+// heap is sampled in the background so that probe requests only read an
+// atomic value and never stop the world.
+type heapGuard struct {
+	max  uint64
+	heap atomic.Uint64
+}
+
+// newHeapGuard returns a heapGuard for max bytes with a first sample
+// taken, or nil if max is not positive.
+func newHeapGuard(max int64) *heapGuard {
+	if max <= 0 {
+		return nil
+	}
+	g := &heapGuard{max: uint64(max)}
+	g.sample()
+	return g
+}
+
+// sample records the current heap size and reports whether it is within
+// the limit.
+func (g *heapGuard) sample() bool {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	g.heap.Store(m.HeapAlloc)
+	return m.HeapAlloc <= g.max
+}
+
+// run samples the heap every heapPollInterval until ctx is done and logs
+// when the limit is crossed in either direction. It is called once, from
+// Run.
+func (g *heapGuard) run(ctx context.Context, log *slog.Logger) {
+	t := time.NewTicker(heapPollInterval)
+	defer t.Stop()
+	ok := g.heap.Load() <= g.max
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		now := g.sample()
+		switch {
+		case ok && !now:
+			log.Warn("heap above MAX_HEAP_BYTES, readiness failing", "heap_alloc_bytes", g.heap.Load(), "max_heap_bytes", g.max)
+		case !ok && now:
+			log.Info("heap back below MAX_HEAP_BYTES", "heap_alloc_bytes", g.heap.Load(), "max_heap_bytes", g.max)
+		}
+		ok = now
+	}
+}
+
+// status reports whether the last sample was within the limit, together
+// with the figures for probe responses:
+//
+//	{"heap_alloc_bytes": <int>, "max_heap_bytes": <int>}
+func (g *heapGuard) status() (ok bool, body map[string]any) {
+	heap := g.heap.Load()
+	return heap <= g.max, map[string]any{
+		"heap_alloc_bytes": heap,
+		"max_heap_bytes":   g.max,
+	}
+}
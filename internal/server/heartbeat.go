@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// Heartbeat logs a "heartbeat" line every interval until ctx is done,
+// reporting uptime, the goroutine count and the probe states, so that a
+// quiet process can still be seen to be alive. A non-positive interval
+// returns immediately. Callers run it in its own goroutine next to Run.
+func (s *Server) Heartbeat(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.log.Info("heartbeat",
+				"uptime", time.Since(s.started).Round(time.Second).String(),
+				"goroutines", runtime.NumGoroutine(),
+				"health", s.health.Load(),
+				"ready", s.ready.Load(),
+				"started", s.startup.Load(),
+			)
+		}
+	}
+}
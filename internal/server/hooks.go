@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// ShutdownHook releases a resource (closes a database, flushes a buffer,
+// ...) when the server stops. It should return promptly once ctx is
+// cancelled.
+type ShutdownHook func(ctx context.Context) error
+
+// WithShutdownHook registers fn to run when Run returns, after the HTTP
+// servers have shut down, whether the shutdown was graceful or caused by
+// a listener error, and also when Run fails to bind its listeners. Hooks
+// run one at a time in reverse registration order (like defer), each
+// bounded by SHUTDOWN_HOOK_TIMEOUT.
+func WithShutdownHook(fn ShutdownHook) Option {
+	return func(o *options) { o.hooks = append(o.hooks, fn) }
+}
+
+// runShutdownHooks runs hooks last to first. A hook that fails or
+// exceeds timeout is logged and does not stop the remaining ones; a hook
+// that ignores its context is left running in the background.
+func runShutdownHooks(hooks []ShutdownHook, timeout time.Duration, log *slog.Logger) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		done := make(chan error, 1)
+		go func() { done <- hooks[i](ctx) }()
+		var err error
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		cancel()
+		if err != nil {
+			log.Warn("shutdown hook failed", "hook", i, "err", err)
+		}
+	}
+}
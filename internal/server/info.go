@@ -0,0 +1,193 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+
+	"bodsch.me/probe-service/internal/config"
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// redacted replaces secret configuration values in /info.
+const redacted = "[redacted]"
+
+// ConfigSnapshot renders the effective configuration for /info and
+// --validate-config. Secrets are never included: ADMIN_TOKEN and the
+// CUSTOM_HEADERS values are reported as "[redacted]", credentials in
+// READY_DEPENDENCY_URL, READY_CHECK_HTTP_* and OTLP URLs are masked, and
+// HEALTH_CHECK_CMD is reduced to its executable. The probe bodies and the
+// TLS_CLIENT_CA and LOG_FILE paths are only reported as set or unset.
+func ConfigSnapshot(cfg config.Config) map[string]any {
+	network, addr := cfg.Listen()
+	adminToken := ""
+	if cfg.AdminToken != "" {
+		adminToken = redacted
+	}
+	customHeaders := make(map[string]string, len(cfg.CustomHeaders))
+	for name := range cfg.CustomHeaders {
+		customHeaders[name] = redacted
+	}
+	readyChecks := make(map[string]string, len(cfg.ReadyChecks))
+	for _, c := range cfg.ReadyChecks {
+		target := c.Target
+		if c.Kind == "http" {
+			target = redactURL(target)
+		}
+		readyChecks[c.Name] = c.Kind + " " + target
+	}
+	return map[string]any{
+		"service":                     cfg.ServiceName,
+		"env_prefix":                  cfg.EnvPrefix,
+		"version":                     cfg.Version,
+		"port":                        cfg.Port,
+		"admin_port":                  cfg.AdminPort,
+		"bind_addr":                   cfg.BindAddr,
+		"admin_bind_addr":             cfg.AdminBindAddr,
+		"listen_network":              network,
+		"listen_addr":                 addr,
+		"listen_fd":                   cfg.ListenFD,
+		"reuseport":                   cfg.ReusePort,
+		"listen_retry_count":          cfg.ListenRetryCount,
+		"listen_retry_delay":          cfg.ListenRetryDelay.String(),
+		"tls":                         cfg.TLSEnabled(),
+		"tls_client_ca":               cfg.TLSClientCA != "",
+		"health_startup_delay":        cfg.HealthStartupDelay.String(),
+		"ready_startup_delay":         cfg.ReadyStartupDelay.String(),
+		"ready_ramp":                  cfg.ReadyRamp,
+		"startup_probe_delay":         cfg.StartupProbeDelay.String(),
+		"startup_delay_jitter":        cfg.StartupDelayJitter.String(),
+		"warmup_duration":             cfg.WarmupDuration.String(),
+		"health_ttl":                  cfg.HealthTTL.String(),
+		"health_script":               cfg.HealthScript.String(),
+		"ready_ttl":                   cfg.ReadyTTL.String(),
+		"health_fail_after_requests":  cfg.HealthFailAfterRequests,
+		"health_grace_after_unready":  cfg.HealthGraceAfterUnready.String(),
+		"health_failure_rate":         cfg.HealthFailureRate,
+		"health_check_cmd":            commandName(cfg.HealthCheckCmd),
+		"health_check_interval":       cfg.HealthCheckInterval.String(),
+		"health_check_timeout":        cfg.HealthCheckTimeout.String(),
+		"min_free_disk_bytes":         cfg.MinFreeDiskBytes,
+		"disk_check_path":             cfg.DiskCheckPath,
+		"max_heap_bytes":              cfg.MaxHeapBytes,
+		"shutdown_wait":               cfg.ShutdownWait.String(),
+		"shutdown_hook_timeout":       cfg.ShutdownHookTimeout.String(),
+		"prestop_delay":               cfg.PreStopDelay.String(),
+		"drain_close_idle":            cfg.DrainCloseIdle,
+		"read_timeout":                cfg.ReadTimeout.String(),
+		"write_timeout":               cfg.WriteTimeout.String(),
+		"idle_timeout":                cfg.IdleTimeout.String(),
+		"disable_keepalive":           cfg.DisableKeepAlive,
+		"max_connections":             cfg.MaxConnections,
+		"max_body_bytes":              cfg.MaxBodyBytes,
+		"max_header_bytes":            cfg.MaxHeaderBytes,
+		"log_level":                   cfg.LogLevel.String(),
+		"log_format":                  cfg.LogFormat,
+		"probe_response_format":       cfg.ProbeResponseFormat,
+		"json_case":                   cfg.JSONCase,
+		"time_format":                 cfg.TimeFormat,
+		"probe_extra_json":            cfg.ProbeExtra,
+		"probe_unhealthy_body":        cfg.ProbeUnhealthyBody.Content != "",
+		"probe_notready_body":         cfg.ProbeNotReadyBody.Content != "",
+		"probe_payload_bytes":         cfg.ProbePayloadBytes,
+		"log_sample_rate":             cfg.LogSampleRate,
+		"log_conn_state":              cfg.LogConnState,
+		"debug_dump_requests":         cfg.DebugDumpRequests,
+		"log_file":                    cfg.LogFile != "",
+		"log_max_size_mb":             cfg.LogMaxSizeMB,
+		"log_max_backups":             cfg.LogMaxBackups,
+		"pod_name":                    cfg.PodName,
+		"pod_namespace":               cfg.PodNamespace,
+		"node_name":                   cfg.NodeName,
+		"heartbeat_interval":          cfg.HeartbeatInterval.String(),
+		"admin_token":                 adminToken,
+		"request_id_header":           cfg.RequestIDHeader,
+		"request_id_max_len":          cfg.RequestIDMaxLen,
+		"response_delay":              cfg.ResponseDelay.String(),
+		"response_delay_max":          cfg.ResponseDelayMax.String(),
+		"handler_timeout":             cfg.HandlerTimeout.String(),
+		"ready_dependency_url":        redactURL(cfg.ReadyDependencyURL),
+		"ready_dependency_timeout":    cfg.ReadyDependencyTimeout.String(),
+		"ready_dependency_ttl":        cfg.ReadyDependencyTTL.String(),
+		"ready_checks":                readyChecks,
+		"ready_file":                  cfg.ReadyFile,
+		"ready_file_nonempty":         cfg.ReadyFileNonEmpty,
+		"ready_after_health_checks":   cfg.ReadyAfterHealthChecks,
+		"rate_limit_rps":              cfg.RateLimitRPS,
+		"rate_limit_burst":            cfg.RateLimitBurst,
+		"rate_limit_per_ip":           cfg.RateLimitPerIP,
+		"enable_compression":          cfg.EnableCompression,
+		"enable_h2c":                  cfg.EnableH2C,
+		"enable_proxy_protocol":       cfg.EnableProxyProtocol,
+		"enable_pprof":                cfg.EnablePprof,
+		"enable_tls_reflect":          cfg.EnableTLSReflect,
+		"static_dir":                  cfg.StaticDir,
+		"static_max_age":              cfg.StaticMaxAge.String(),
+		"cors_allowed_origins":        cfg.CORSAllowedOrigins,
+		"custom_headers":              customHeaders,
+		"enable_security_headers":     cfg.EnableSecurityHeaders,
+		"enable_remote_shutdown":      cfg.EnableRemoteShutdown,
+		"admin_enabled":               !cfg.AdminDisabled,
+		"admin_reset_enabled":         !cfg.AdminResetDisabled,
+		"reset_min_interval":          cfg.ResetMinInterval.String(),
+		"enable_tracing":              cfg.EnableTracing,
+		"otel_exporter_otlp_endpoint": redactURL(cfg.OTLPEndpoint),
+	}
+}
+
+// redactURL masks the password of a URL with url.URL.Redacted. Empty and
+// unparseable values are returned unchanged.
+func redactURL(s string) string {
+	if u, err := url.Parse(s); err == nil && s != "" {
+		return u.Redacted()
+	}
+	return s
+}
+
+// runtimeSnapshot reports goroutine, scheduler and memory statistics.
+// runtime.ReadMemStats briefly stops the world, which is acceptable for
+// an on-demand diagnostics endpoint.
+func runtimeSnapshot() map[string]any {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return map[string]any{
+		"go_version":        runtime.Version(),
+		"goroutines":        runtime.NumGoroutine(),
+		"gomaxprocs":        runtime.GOMAXPROCS(0),
+		"num_cpu":           runtime.NumCPU(),
+		"heap_alloc_bytes":  m.HeapAlloc,
+		"heap_sys_bytes":    m.HeapSys,
+		"heap_objects":      m.HeapObjects,
+		"total_alloc_bytes": m.TotalAlloc,
+		"sys_bytes":         m.Sys,
+		"num_gc":            m.NumGC,
+	}
+}
+
+// infoHandler builds a GET-only handler that reports the effective
+// configuration and runtime statistics. Like /version it always returns
+// 200, independent of the probe state.
+//
+//	{
+//	  "config":     {<effective configuration, secrets redacted>},
+//	  "runtime":    {<goroutines, GOMAXPROCS, memory statistics>},
+//	  "started_at": "<RFC3339 process start time>",
+//	  "uptime_ms":  <int>,
+//	  "time":       "<RFC3339>"
+//	}
+func infoHandler(cfg config.Config, started time.Time) http.HandlerFunc {
+	snapshot := ConfigSnapshot(cfg)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet) {
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"config":     snapshot,
+			"runtime":    runtimeSnapshot(),
+			"started_at": httpx.FormatTime(r, started),
+			"uptime_ms":  time.Since(started).Milliseconds(),
+			"time":       httpx.Timestamp(r),
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileListener returns a listener for the inherited, already listening
+// socket fd (LISTEN_FD or systemd socket activation). net.FileListener
+// duplicates the descriptor, so the original is closed afterwards.
+func fileListener(fd int) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), "listener")
+	if f == nil {
+		return nil, fmt.Errorf("listen fd %d: invalid file descriptor", fd)
+	}
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("listen fd %d: %w", fd, err)
+	}
+	return ln, nil
+}
+
+// listen binds network/addr like net.Listen. With reusePort the socket
+// gets SO_REUSEPORT before it is bound, so other processes that set it
+// too can listen on the same port and the kernel spreads connections
+// between them.
+func listen(ctx context.Context, network, addr string, reusePort bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(ctx, network, addr)
+}
+
+// maxListenRetryDelay caps the doubling bind retry delay, so that a high
+// LISTEN_RETRY_COUNT does not lead to waits of hours. A larger
+// LISTEN_RETRY_DELAY is used as is.
+const maxListenRetryDelay = 30 * time.Second
+
+// nextRetryDelay doubles the bind retry delay d up to maxListenRetryDelay.
+func nextRetryDelay(d time.Duration) time.Duration {
+	if d >= maxListenRetryDelay {
+		return d
+	}
+	return min(2*d, maxListenRetryDelay)
+}
+
+// bind calls listen for network/addr, retrying up to
+// cfg.ListenRetryCount times while the address is in use, with a delay
+// that starts at cfg.ListenRetryDelay and doubles per attempt up to
+// maxListenRetryDelay. Other errors, and a cancelled ctx, end the
+// attempts at once.
+func (s *Server) bind(ctx context.Context, network, addr string) (net.Listener, error) {
+	delay := s.cfg.ListenRetryDelay
+	for attempt := 1; ; attempt++ {
+		ln, err := listen(ctx, network, addr, s.cfg.ReusePort)
+		if err == nil || !addrInUse(err) || attempt > s.cfg.ListenRetryCount {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("%w (after %d retries)", err, attempt-1)
+			}
+			return ln, err
+		}
+		s.log.Warn("address in use, retrying",
+			"network", network,
+			"addr", addr,
+			"attempt", attempt,
+			"retries", s.cfg.ListenRetryCount,
+			"retry_in", delay.String(),
+		)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+		delay = nextRetryDelay(delay)
+	}
+}
+
+// limitListener accepts at most cap(sem) simultaneous connections. Once
+// the limit is reached Accept blocks until an accepted connection is
+// closed, leaving further clients in the kernel's accept backlog.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newLimitListener wraps ln with a limit of n connections. A non-positive
+// n returns ln unchanged.
+func newLimitListener(ln net.Listener, n int) net.Listener {
+	if n <= 0 {
+		return ln
+	}
+	return &limitListener{Listener: ln, sem: make(chan struct{}, n), done: make(chan struct{})}
+}
+
+// Accept waits for a free slot, then for the next connection.
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: func() { <-l.sem }}, nil
+}
+
+// Close closes the listener and unblocks a pending Accept.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn frees its listener slot when it is closed.
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+// NetConn returns the wrapped connection.
+func (c *limitConn) NetConn() net.Conn { return c.Conn }
+
+// Close closes the connection and frees the slot (once).
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// maintenanceLabel is the probe status while maintenance mode is on.
+const maintenanceLabel = "maintenance"
+
+// maintenanceGate answers every request with 503 "maintenance" while on
+// is set, before routing, except /admin/* and /metrics so that the mode
+// can be switched off again and the service stays observable. Probes are
+// passed on: their handlers see on as well and answer 503 with status
+// "maintenance" in their usual format.
+func maintenanceGate(on *atomic.Bool) httpx.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !on.Load() || isProbeRequest(r) || strings.HasPrefix(r.URL.Path, "/admin/") || r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			httpx.WriteError(w, r, http.StatusServiceUnavailable, "maintenance")
+		})
+	}
+}
+
+// maintenanceHandler builds a POST-only handler that switches maintenance
+// mode to v and reports the new state:
+//
+//	{"maintenance": <bool>, "time": "<RFC3339>"}
+func maintenanceHandler(on *atomic.Bool, v bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodPost) || !httpx.RequireJSON(w, r) {
+			return
+		}
+		on.Store(v)
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{
+			"maintenance": v,
+			"time":        httpx.Timestamp(r),
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// openAPISpec is the hand-maintained OpenAPI 3 description of all routes.
+// Keep it in step with the handlers; TestOpenAPI checks that every path it
+// lists is routed.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIHandler builds a GET-only handler serving openAPISpec.
+func openAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(openAPISpec)
+	}
+}
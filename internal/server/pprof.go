@@ -0,0 +1,45 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+
+	"bodsch.me/probe-service/internal/config"
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// withPprof mounts the net/http/pprof handlers under /debug/pprof/ in
+// front of app. It is only used when cfg.EnablePprof is true.
+//
+// Security: pprof exposes goroutine stacks, heap contents, the full
+// command line and lets callers run CPU profiles and execution traces
+// that cost real CPU time. Anyone who can reach these routes can read
+// secrets held in memory and degrade the service. They are therefore
+// disabled by default, protected by ADMIN_TOKEN when one is configured,
+// and must never be exposed outside a trusted network.
+//
+// The pprof routes deliberately get their own, shorter middleware chain:
+// MaxBody and Latency would interfere with profile uploads (POST
+// /debug/pprof/symbol) and long-running profiles, and they are not part
+// of the application metrics.
+func withPprof(app http.Handler, cfg config.Config, log *slog.Logger) http.Handler {
+	debug := http.NewServeMux()
+	debug.HandleFunc("/debug/pprof/", pprof.Index)
+	debug.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	debug.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	debug.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	root := http.NewServeMux()
+	root.Handle("/", app)
+	root.Handle("/debug/pprof/", httpx.Chain(debug,
+		httpx.RequestIDMaxLen(cfg.RequestIDHeader, cfg.RequestIDMaxLen),
+		httpx.ClientIP(cfg.TrustedProxies),
+		httpx.AccessLog(log),
+		httpx.Recoverer(log),
+		httpx.ServiceVersion(cfg.Version),
+		httpx.BearerAuth(cfg.AdminToken),
+	))
+	return root
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"sync"
+
+	"bodsch.me/probe-service/pkg/flagx"
+)
+
+// ramp turns the flip of a flag at the end of its delay into a slow start
+// (READY_RAMP). During the first half of the delay every request fails;
+// during the second half the share of passing requests grows linearly
+// from 0 to 1. Passes are spread evenly instead of drawn at random, so a
+// given share lets through exactly that fraction of consecutive requests.
+type ramp struct {
+	mu  sync.Mutex
+	acc float64
+}
+
+// rampShare maps the elapsed fraction of the delay to the share of
+// requests that pass.
+func rampShare(elapsed float64) float64 {
+	return min(max(2*elapsed-1, 0), 1)
+}
+
+// pass reports whether the next request passes at the given elapsed
+// fraction of the delay.
+func (r *ramp) pass(elapsed float64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acc += rampShare(elapsed)
+	if r.acc >= 1 {
+		r.acc--
+		return true
+	}
+	return false
+}
+
+// elapsed returns the fraction of f's running delay that has passed, or
+// 0 when no delay is running (the flag is held down or was set
+// explicitly). The running delay is the effective one, which includes
+// jitter and the delay override of an admin reset.
+func elapsed(f *flagx.DelayedFlag) float64 {
+	remaining, delay := f.Remaining(), f.EffectiveDelay()
+	if remaining <= 0 || delay <= 0 {
+		return 0
+	}
+	return 1 - float64(remaining)/float64(delay)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// tlsReflectHandler builds a GET-only handler that reports the TLS
+// parameters of the connection the request arrived on, to diagnose
+// handshake problems behind load balancers and proxies. It is only
+// registered with cfg.EnableTLSReflect, on the main listener, which then
+// requests (but neither requires nor verifies) a client certificate; see
+// reflectTLSConfig.
+//
+//	{
+//	  "tls":                 true,
+//	  "version":             "TLS 1.3",
+//	  "cipher_suite":        "TLS_AES_128_GCM_SHA256",
+//	  "server_name":         "<SNI, empty if none was sent>",
+//	  "negotiated_protocol": "<ALPN, e.g. h2>",
+//	  "client_cert":         <bool>,
+//	  "client_cert_subject": "<subject of the leaf, only with client_cert>",
+//	  "time":                "<RFC3339>"
+//	}
+//
+// On a plain HTTP connection, typically because a proxy terminates TLS in
+// front of the service, it answers 200 with "tls": false and a message.
+func tlsReflectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet) {
+			return
+		}
+		cs := r.TLS
+		if cs == nil {
+			httpx.WriteJSON(w, http.StatusOK, map[string]any{
+				"tls":     false,
+				"message": "connection is not TLS; if a proxy terminates TLS, its handshake is not visible here",
+				"time":    httpx.Timestamp(r),
+			})
+			return
+		}
+		body := map[string]any{
+			"tls":                 true,
+			"version":             tls.VersionName(cs.Version),
+			"cipher_suite":        tls.CipherSuiteName(cs.CipherSuite),
+			"server_name":         cs.ServerName,
+			"negotiated_protocol": cs.NegotiatedProtocol,
+			"client_cert":         len(cs.PeerCertificates) > 0,
+			"time":                httpx.Timestamp(r),
+		}
+		if len(cs.PeerCertificates) > 0 {
+			body["client_cert_subject"] = cs.PeerCertificates[0].Subject.String()
+		}
+		httpx.WriteJSON(w, http.StatusOK, body)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build darwin || freebsd || dragonfly
+
+package server
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
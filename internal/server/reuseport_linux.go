@@ -0,0 +1,7 @@
+//go:build !(mips || mipsle || mips64 || mips64le)
+
+package server
+
+// soReusePort is SO_REUSEPORT from <asm-generic/socket.h>; the frozen
+// syscall package does not define it for Linux.
+const soReusePort = 0xf
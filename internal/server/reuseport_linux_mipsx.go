@@ -0,0 +1,6 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+
+package server
+
+// soReusePort is SO_REUSEPORT from MIPS's <asm/socket.h>.
+const soReusePort = 0x200
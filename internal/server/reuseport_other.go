@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || dragonfly)
+
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl fails: SO_REUSEPORT is not supported on this platform.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("REUSEPORT not supported on this platform")
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package server
+
+import "syscall"
+
+// reusePortControl is a net.ListenConfig Control function that sets
+// SO_REUSEPORT on the socket before it is bound (REUSEPORT).
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -2,33 +2,122 @@ package server
 
 import (
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"bodsch.me/probe-service/internal/config"
-	"bodsch.me/probe-service/internal/flagx"
+	"bodsch.me/probe-service/internal/metrics"
+	"bodsch.me/probe-service/pkg/flagx"
+	"bodsch.me/probe-service/pkg/httpx"
 )
 
-// registerRoutes attaches all HTTP routes to mux. Liveness and readiness
-// each have two URL aliases (the Kubernetes-style /healthz | /readyz and
-// the Spring Actuator-style paths) but share a single handler closure.
-func registerRoutes(mux *http.ServeMux, cfg config.Config, health, ready *flagx.DelayedFlag) {
-	liveness := probeHandler(health, livenessLabels, cfg.ServiceName, cfg.Version)
-	readiness := probeHandler(ready, readinessLabels, cfg.ServiceName, cfg.Version)
+// probePaths are the liveness, readiness and startup routes. They are
+// exempt from rate limiting so that orchestration probes are never
+// throttled.
+var probePaths = map[string]bool{
+	"/healthz":                   true,
+	"/livez":                     true,
+	"/actuator/health/liveness":  true,
+	"/readyz":                    true,
+	"/actuator/health/readiness": true,
+	"/startupz":                  true,
+}
+
+// isProbeRequest reports whether r targets one of probePaths.
+func isProbeRequest(r *http.Request) bool { return probePaths[r.URL.Path] }
+
+// isDelayableRequest reports whether r may use the ?delay= override:
+// probes, /metrics and the admin API may not, so that no client can hold
+// them open.
+func isDelayableRequest(r *http.Request) bool {
+	return !isProbeRequest(r) && r.URL.Path != "/metrics" && !strings.HasPrefix(r.URL.Path, "/admin/")
+}
+
+// isVerbatimRequest reports whether r asks for the OpenAPI document, which
+// describes the default snake_case keys, or a STATIC_DIR file. Their
+// JSON is never rewritten.
+func isVerbatimRequest(r *http.Request) bool {
+	return r.URL.Path == "/openapi.json" || strings.HasPrefix(r.URL.Path, staticPrefix+"/")
+}
+
+// registerPublicRoutes attaches the probe routes (including /startupz),
+// /version, /info, /openapi.json, the /status/{code} and /echo debug
+// helpers, /reflect/tls with cfg.EnableTLSReflect and, with
+// cfg.StaticDir, the /static/ file server to mux.
+//
+// Liveness and readiness each have several URL aliases (the
+// Kubernetes-style /healthz, /livez | /readyz and the Spring
+// Actuator-style paths) but share a single handler closure. The probes
+// and /info report started as the process start time.
+func registerPublicRoutes(mux *http.ServeMux, cfg config.Config, health, ready, startup *flagx.DelayedFlag, wu *warmup, hg *heapGuard, hc *healthCommand, draining, maintenance *atomic.Bool, started time.Time) {
+	passes := newHealthPasses(cfg.ReadyAfterHealthChecks)
+	liveness := livenessHandler(cfg, health, hc, passes, maintenance, started)
+	readiness := readinessHandler(cfg, ready, wu, hg, passes, draining, maintenance, started)
 
 	mux.HandleFunc("/healthz", liveness)
+	mux.HandleFunc("/livez", liveness)
 	mux.HandleFunc("/actuator/health/liveness", liveness)
 	mux.HandleFunc("/readyz", readiness)
 	mux.HandleFunc("/actuator/health/readiness", readiness)
+	mux.HandleFunc("/startupz", startupHandler(cfg, startup, maintenance, started))
+
+	mux.HandleFunc("/version", versionHandler(cfg))
+	mux.HandleFunc("/info", infoHandler(cfg, started))
+	mux.HandleFunc("/status/{code}", statusCodeHandler())
+	mux.HandleFunc("/echo", echoHandler())
+	mux.HandleFunc("/openapi.json", openAPIHandler())
+	if cfg.EnableTLSReflect {
+		mux.HandleFunc("/reflect/tls", tlsReflectHandler())
+	}
+	if cfg.StaticDir != "" {
+		mux.Handle(staticPrefix+"/", http.StripPrefix(staticPrefix, staticHandler(cfg.StaticDir, cfg.StaticMaxAge)))
+	}
+}
+
+// registerAdminRoutes attaches /metrics and the /admin/* routes to mux.
+// They are served on the admin listener when ADMIN_PORT is set, and on
+// the main listener otherwise.
+//
+// shutdown is called by POST /admin/shutdown, which is only registered
+// when cfg.EnableRemoteShutdown is set.
+//
+// startup is only reported by /admin/status and /admin/stats; no admin
+// route resets it.
+//
+// With cfg.AdminDisabled only /metrics is registered, and with
+// cfg.AdminResetDisabled the reset, up, down and maintenance routes are
+// left out, so disabled routes answer 404 instead of being reachable at
+// all.
+func registerAdminRoutes(mux *http.ServeMux, cfg config.Config, health, ready, startup *flagx.DelayedFlag, reg *metrics.Registry, stats *requestStats, maintenance *atomic.Bool, shutdown func()) {
+	mux.HandleFunc("/metrics", reg.Handler())
+	if cfg.AdminDisabled {
+		return
+	}
+
+	healthTarget := flagTarget{stateKey: "health", remainingKey: "health_in_ms", delayKey: "health_delay", effectiveKey: "health_effective_delay", heldKey: "health_held", flag: health}
+	readyTarget := flagTarget{stateKey: "ready", remainingKey: "ready_in_ms", delayKey: "ready_delay", effectiveKey: "ready_effective_delay", heldKey: "ready_held", flag: ready}
+	startupTarget := flagTarget{stateKey: "startup", remainingKey: "startup_in_ms", delayKey: "startup_delay", effectiveKey: "startup_effective_delay", heldKey: "startup_held", flag: startup}
+
+	// All /admin/* routes are wrapped with BearerAuth, which is a no-op
+	// when no ADMIN_TOKEN is configured.
+	admin := httpx.BearerAuth(cfg.AdminToken)
 
-	delayStr := cfg.StartupDelay.String()
-
-	mux.HandleFunc("/admin/reset", resetHandler(delayStr,
-		resetTarget{stateKey: "health", remainingKey: "health_in_ms", flag: health},
-		resetTarget{stateKey: "ready", remainingKey: "ready_in_ms", flag: ready},
-	))
-	mux.HandleFunc("/admin/health/reset", resetHandler(delayStr,
-		resetTarget{stateKey: "health", remainingKey: "health_in_ms", flag: health},
-	))
-	mux.HandleFunc("/admin/ready/reset", resetHandler(delayStr,
-		resetTarget{stateKey: "ready", remainingKey: "ready_in_ms", flag: ready},
-	))
+	mux.Handle("/admin/status", admin(statusHandler(healthTarget, readyTarget, startupTarget)))
+	mux.Handle("/admin/stats", admin(statsHandler(stats, healthTarget, readyTarget, startupTarget)))
+	if !cfg.AdminResetDisabled {
+		throttle := newResetThrottle(cfg.ResetMinInterval)
+		mux.Handle("/admin/reset", admin(resetHandler(throttle, healthTarget, readyTarget)))
+		mux.Handle("/admin/health/reset", admin(resetHandler(throttle, healthTarget)))
+		mux.Handle("/admin/ready/reset", admin(resetHandler(throttle, readyTarget)))
+		mux.Handle("/admin/health/up", admin(upHandler(healthTarget)))
+		mux.Handle("/admin/ready/up", admin(upHandler(readyTarget)))
+		mux.Handle("/admin/health/down", admin(downHandler(healthTarget)))
+		mux.Handle("/admin/ready/down", admin(downHandler(readyTarget)))
+		mux.Handle("/admin/maintenance/on", admin(maintenanceHandler(maintenance, true)))
+		mux.Handle("/admin/maintenance/off", admin(maintenanceHandler(maintenance, false)))
+	}
+	if cfg.EnableRemoteShutdown {
+		mux.Handle("/admin/shutdown", admin(shutdownHandler(shutdown)))
+	}
 }
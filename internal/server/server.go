@@ -2,129 +2,683 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"bodsch.me/probe-service/internal/config"
-	"bodsch.me/probe-service/internal/flagx"
-	"bodsch.me/probe-service/internal/httpx"
+	"bodsch.me/probe-service/internal/metrics"
+	"bodsch.me/probe-service/internal/tracing"
+	"bodsch.me/probe-service/pkg/flagx"
+	"bodsch.me/probe-service/pkg/httpx"
+	"bodsch.me/probe-service/pkg/proxyproto"
 )
 
+// proxyHeaderTimeout bounds the wait for the PROXY protocol header of a
+// new connection, like ReadHeaderTimeout does for the request headers.
+const proxyHeaderTimeout = 5 * time.Second
+
 // Server is the runnable application. Public callers should treat it as
 // opaque except for Run.
 type Server struct {
-	cfg    config.Config
-	log    *slog.Logger
-	http   *http.Server
+	cfg  config.Config
+	log  *slog.Logger
+	http *http.Server
+	// admin serves /admin/*, /metrics and pprof on a separate port. It is
+	// nil unless cfg.SplitAdmin() is true, in which case those routes are
+	// not registered on http.
+	admin  *http.Server
 	health *flagx.DelayedFlag
 	ready  *flagx.DelayedFlag
+	// startup backs /startupz. It flips once and is never reset.
+	startup *flagx.DelayedFlag
+	// warmup gates readiness on a WarmupFunc started by Run; nil if none.
+	warmup *warmup
+	// heap gates readiness on MAX_HEAP_BYTES, sampled by a goroutine
+	// started by Run; nil if disabled.
+	heap *heapGuard
+	// command gates liveness on HEALTH_CHECK_CMD, run periodically by a
+	// goroutine started by Run; nil if disabled.
+	command *healthCommand
+	// grace holds liveness after a readiness loss longer than
+	// HEALTH_GRACE_AFTER_UNREADY, watched by a goroutine started by Run;
+	// nil if disabled.
+	grace *unreadyGrace
+	// draining is set once Run begins its graceful shutdown; readiness
+	// then reports "draining" instead of "not-ready".
+	draining *atomic.Bool
+	// started is the process start time (WithStartTime, or when New built
+	// the server); uptime is measured from it.
+	started time.Time
+	// tracer exports request spans; nil unless cfg.EnableTracing.
+	tracer *tracing.Tracer
+	// stop is closed (once) by requestShutdown to make Run shut down as
+	// if its context had been cancelled.
+	stop     chan struct{}
+	stopOnce sync.Once
+	// hooks are the WithShutdownHook functions, run when Run returns.
+	hooks []ShutdownHook
+}
+
+// timeFormat maps TIME_FORMAT to its httpx.TimeFormat; anything else,
+// including "", is RFC3339.
+func timeFormat(name string) httpx.TimeFormat {
+	switch name {
+	case "rfc3339nano":
+		return httpx.TimeRFC3339Nano
+	case "unixmillis":
+		return httpx.TimeUnixMillis
+	default:
+		return httpx.TimeRFC3339
+	}
 }
 
 // New builds a Server with all routes and middleware in place. It does
 // not bind the listening socket; that happens in Run so that test code
 // can construct a Server in process without holding a port.
-func New(cfg config.Config, log *slog.Logger) (*Server, error) {
+//
+// New fails if cfg.TLSClientCA cannot be read.
+func New(cfg config.Config, log *slog.Logger, opts ...Option) (*Server, error) {
 	if log == nil {
 		return nil, errors.New("server.New: nil logger")
 	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	wu := newWarmup(cfg, o)
+	hg := newHeapGuard(cfg.MaxHeapBytes)
+	hc := newHealthCommand(cfg.HealthCheckCmd, cfg.HealthCheckInterval, cfg.HealthCheckTimeout)
+	draining := new(atomic.Bool)
+	started := o.started
+	if started.IsZero() {
+		started = time.Now()
+	}
+
+	for _, entry := range cfg.CustomHeadersSkipped {
+		log.Warn("ignoring invalid CUSTOM_HEADERS entry", "entry", entry)
+	}
 
-	health := flagx.NewDelayedFlag(cfg.StartupDelay)
-	ready := flagx.NewDelayedFlag(cfg.StartupDelay)
+	jitter := flagx.WithJitter(cfg.StartupDelayJitter)
+	health := flagx.NewDelayedFlag(cfg.HealthStartupDelay, flagx.WithTTL(cfg.HealthTTL), flagx.WithScript(cfg.HealthScript), jitter)
+	ready := flagx.NewDelayedFlag(cfg.ReadyStartupDelay, flagx.WithTTL(cfg.ReadyTTL), jitter)
+	startup := flagx.NewDelayedFlag(cfg.StartupProbeDelay, jitter)
+
+	reg := metrics.NewRegistry()
+	reg.GaugeFunc("probe_healthy", "1 if the liveness flag is true, 0 otherwise.", flagGauge(health))
+	reg.GaugeFunc("probe_ready", "1 if the readiness flag is true, 0 otherwise.", flagGauge(ready))
+	reg.GaugeFunc("probe_started", "1 if the startup flag is true, 0 otherwise.", flagGauge(startup))
+	stats := newRequestStats()
+	maintenance := new(atomic.Bool)
+
+	var tracer *tracing.Tracer
+	if cfg.EnableTracing {
+		tracer = tracing.New(cfg.ServiceName, cfg.OTLPEndpoint, log)
+	}
 
 	mux := http.NewServeMux()
-	registerRoutes(mux, cfg, health, ready)
-
-	// Middleware order matters:
-	//   RequestID is outermost so the ID is in r.Context() for every layer
-	//   below it (otherwise the WithContext rebind inside RequestID is
-	//   invisible to outer middlewares' deferred log statements).
-	//   AccessLog then Recoverer follow, so panic responses are still logged
-	//   with status 500 and the request ID. ServiceVersion sets a response
-	//   header and therefore must run before any WriteHeader. MaxBody only
-	//   affects the inner handler.
-	handler := httpx.Chain(mux,
-		httpx.RequestID(),
-		httpx.AccessLog(log),
-		httpx.Recoverer(log),
-		httpx.ServiceVersion(cfg.Version),
-		httpx.MaxBody(cfg.MaxBodyBytes),
-	)
+	registerPublicRoutes(mux, cfg, health, ready, startup, wu, hg, hc, draining, maintenance, started)
+
+	s := &Server{
+		cfg:      cfg,
+		log:      log,
+		health:   health,
+		ready:    ready,
+		startup:  startup,
+		warmup:   wu,
+		heap:     hg,
+		command:  hc,
+		grace:    newUnreadyGrace(cfg.HealthGraceAfterUnready, health, ready),
+		draining: draining,
+		started:  started,
+		tracer:   tracer,
+		stop:     make(chan struct{}),
+		hooks:    o.hooks,
+	}
+
+	if cfg.SplitAdmin() {
+		adminMux := http.NewServeMux()
+		registerAdminRoutes(adminMux, cfg, health, ready, startup, reg, stats, maintenance, s.requestShutdown)
+		adminHandler := wrap(adminMux, cfg, log, reg, stats, maintenance, tracer, o.middleware)
+		if cfg.EnablePprof {
+			adminHandler = withPprof(adminHandler, cfg, log)
+		}
+		s.admin = newHTTPServer(cfg, log, cfg.AdminListenAddr(), adminHandler)
+		if cfg.TLSClientCA != "" {
+			tc, err := clientCertConfig(cfg.TLSClientCA)
+			if err != nil {
+				return nil, err
+			}
+			s.admin.TLSConfig = tc
+		}
+
+		_, addr := cfg.Listen()
+		handler := failAfterRequests(cfg.HealthFailAfterRequests, health, log)(wrap(mux, cfg, log, reg, stats, maintenance, tracer, o.middleware))
+		s.http = newHTTPServer(cfg, log, addr, handler)
+		s.http.TLSConfig = reflectTLSConfig(cfg)
+		return s, nil
+	}
+
+	registerAdminRoutes(mux, cfg, health, ready, startup, reg, stats, maintenance, s.requestShutdown)
+	handler := failAfterRequests(cfg.HealthFailAfterRequests, health, log)(wrap(mux, cfg, log, reg, stats, maintenance, tracer, o.middleware))
+	if cfg.EnablePprof {
+		handler = withPprof(handler, cfg, log)
+	}
+	_, addr := cfg.Listen()
+	s.http = newHTTPServer(cfg, log, addr, handler)
+	s.http.TLSConfig = reflectTLSConfig(cfg)
+	return s, nil
+}
+
+// wrap applies the standard middleware stack, followed by the custom
+// WithMiddleware ones, to mux. The stack is declared as a table, outermost
+// first; optional layers are switched on by their config flag. tracer may
+// be nil.
+//
+// Middleware order matters:
+//
+//   - RequestID is outermost so the ID is in r.Context() for every layer
+//     below it (otherwise the WithContext rebind inside RequestID is
+//     invisible to outer middlewares' deferred log statements).
+//     WithTimeFormat, ClientIP and the tracing middleware (optional)
+//     likewise rebind the context and so also sit above AccessLog.
+//     DumpRequests (optional) follows them so that dumps carry the
+//     request ID.
+//   - AccessLog, the metrics and /admin/stats middleware, then Recoverer
+//     follow, so panic responses are still logged and counted with status
+//     500 and the request ID. Nothing between the tracing middleware and
+//     the mux may replace *http.Request, because the span name and the
+//     path label are read from r.Pattern after routing (Timeout copies
+//     r.Pattern back). Recoverer therefore reports a panic to AccessLog
+//     through its StatusWriter, not through the context.
+//   - Compress (optional) sits inside AccessLog so that the logged byte
+//     count is the compressed size. CamelCaseJSON (optional) sits inside
+//     Compress, so it rewrites the plain JSON, and outside Recoverer, so
+//     panic responses are rewritten too.
+//   - RejectMalformed and the maintenance gate follow ServiceVersion,
+//     inside AccessLog and metrics, so their 400 and 503 responses are
+//     versioned, logged and counted.
+//   - ServiceVersion, SecurityHeaders (optional) and StaticHeaders set
+//     response headers and therefore must run before any WriteHeader.
+//     CORS answers preflights itself, so it sits before Latency and the
+//     handlers. RateLimit follows CORS so that rejected requests still
+//     carry CORS headers and are logged and counted. MaxBody only affects
+//     the inner handler.
+//   - Timeout wraps Latency so that an injected delay can trigger the 504,
+//     and sits inside AccessLog and metrics so the 504 is recorded.
+//   - Latency is innermost so the injected delay shows up in the access
+//     log and metrics durations.
+func wrap(mux *http.ServeMux, cfg config.Config, log *slog.Logger, reg *metrics.Registry, stats *requestStats, maintenance *atomic.Bool, tracer *tracing.Tracer, custom []httpx.Middleware) http.Handler {
+	stack := []struct {
+		enabled bool
+		mw      httpx.Middleware
+	}{
+		{true, httpx.RequestIDMaxLen(cfg.RequestIDHeader, cfg.RequestIDMaxLen)},
+		{true, httpx.WithTimeFormat(timeFormat(cfg.TimeFormat))},
+		{true, httpx.ClientIP(cfg.TrustedProxies)},
+		{tracer != nil, tracer.Middleware()},
+		{cfg.DebugDumpRequests, httpx.DumpRequests(log, cfg.MaxBodyBytes)},
+		{true, httpx.SampledAccessLog(log, cfg.LogSampleRate, isProbeRequest, nil)},
+		{true, reg.Middleware()},
+		{true, stats.Middleware()},
+		{cfg.EnableCompression, httpx.Compress()},
+		{cfg.JSONCase == "camel", httpx.CamelCaseJSON(isVerbatimRequest)},
+		{true, httpx.Recoverer(log)},
+		{true, httpx.ServiceVersion(cfg.Version)},
+		{true, httpx.RejectMalformed()},
+		{true, maintenanceGate(maintenance)},
+		{cfg.EnableSecurityHeaders, httpx.SecurityHeaders(cfg.HSTSMaxAge)},
+		{true, httpx.StaticHeaders(cfg.CustomHeaders)},
+		{true, httpx.CORS(cfg.CORSAllowedOrigins)},
+		{true, httpx.RateLimit(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitPerIP, isProbeRequest)},
+		{true, httpx.MaxBody(cfg.MaxBodyBytes)},
+		{true, httpx.Timeout(cfg.HandlerTimeout, isProbeRequest)},
+		{true, httpx.ScopedLatency(cfg.ResponseDelay, cfg.ResponseDelayMax, isDelayableRequest)},
+	}
+	mws := make([]httpx.Middleware, 0, len(stack)+len(custom))
+	for _, layer := range stack {
+		if layer.enabled {
+			mws = append(mws, layer.mw)
+		}
+	}
+	mws = append(mws, custom...)
+	return httpx.Chain(mux, mws...)
+}
+
+// WithMiddleware adds mws to the middleware stack of every listener, in
+// the given order and innermost, right around the routes: they see the
+// request ID, client IP and size-limited body, run under the handler
+// timeout, and their responses and panics are logged, counted and
+// recovered like the handlers'. Like the handlers, they must not replace
+// *http.Request unless they copy r.Pattern back.
+func WithMiddleware(mws ...httpx.Middleware) Option {
+	return func(o *options) { o.middleware = append(o.middleware, mws...) }
+}
+
+// failAfterRequests counts the requests served through it and, once the
+// count reaches n, holds health at false and logs a warning. It trips only
+// once; an admin "up" or Release clears the hold as usual. A non-positive
+// n disables it.
+func failAfterRequests(n int64, health *flagx.DelayedFlag, log *slog.Logger) httpx.Middleware {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		var served atomic.Int64
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			if served.Add(1) == n {
+				health.Hold()
+				log.Warn("request budget exhausted, liveness now failing", "requests", n)
+			}
+		})
+	}
+}
 
+// newHTTPServer builds an http.Server for addr with the configured
+// timeouts and the error log routed through slog. With cfg.EnableH2C it
+// also accepts unencrypted HTTP/2 (prior knowledge, as used by gRPC
+// clients); HTTP/1.1 keeps working on the same port.
+func newHTTPServer(cfg config.Config, log *slog.Logger, addr string, h http.Handler) *http.Server {
 	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%d", cfg.Port),
-		Handler:           handler,
+		Addr:              addr,
+		Handler:           h,
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       cfg.ReadTimeout,
 		WriteTimeout:      cfg.WriteTimeout,
 		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
 		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelError),
 	}
+	if cfg.EnableH2C {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetHTTP2(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return srv
+}
 
-	return &Server{
-		cfg:    cfg,
-		log:    log,
-		http:   srv,
-		health: health,
-		ready:  ready,
+// reflectTLSConfig returns a TLS configuration for the main listener that
+// asks clients for a certificate without requiring or verifying it, so
+// that /reflect/tls can report one. It returns nil (the default) unless
+// both TLS and ENABLE_TLS_REFLECT are on.
+func reflectTLSConfig(cfg config.Config) *tls.Config {
+	if !cfg.EnableTLSReflect || !cfg.TLSEnabled() {
+		return nil
+	}
+	return &tls.Config{ClientAuth: tls.RequestClientCert}
+}
+
+// clientCertConfig returns a TLS configuration that requires and verifies
+// client certificates against the CA certificates in the PEM file caFile
+// (TLS_CLIENT_CA). The server certificate is added by ServeTLS.
+func clientCertConfig(caFile string) (*tls.Config, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("TLS_CLIENT_CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("TLS_CLIENT_CA: no PEM certificates in %s", caFile)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
 	}, nil
 }
 
+// flagGauge adapts a DelayedFlag to a metrics gauge callback (1 or 0).
+func flagGauge(f *flagx.DelayedFlag) func() float64 {
+	return func() float64 {
+		if f.Load() {
+			return 1
+		}
+		return 0
+	}
+}
+
 // Handler returns the fully composed root http.Handler, primarily for
 // tests that want to drive the server via httptest without binding a port.
 func (s *Server) Handler() http.Handler { return s.http.Handler }
 
-// Run binds the listener and serves until ctx is cancelled, then performs
-// a graceful shutdown bounded by cfg.ShutdownWait.
+// AdminHandler returns the handler serving the admin routes. It is the
+// same as Handler unless a separate admin port is configured.
+func (s *Server) AdminHandler() http.Handler {
+	if s.admin != nil {
+		return s.admin.Handler
+	}
+	return s.http.Handler
+}
+
+// SetKeepAlivesEnabled controls HTTP keep-alive on all listeners, like
+// http.Server.SetKeepAlivesEnabled. With false every response carries
+// "Connection: close" (DISABLE_KEEPALIVE). Call it before Run.
+func (s *Server) SetKeepAlivesEnabled(v bool) {
+	s.http.SetKeepAlivesEnabled(v)
+	if s.admin != nil {
+		s.admin.SetKeepAlivesEnabled(v)
+	}
+}
+
+// SetReady forces readiness from outside HTTP, e.g. from a signal
+// handler: true acts like POST /admin/ready/up, false like
+// POST /admin/ready/down (held until an admin reset or up).
+func (s *Server) SetReady(ready bool) {
+	if ready {
+		s.ready.Set(true)
+		return
+	}
+	s.ready.Hold()
+}
+
+// Run binds the listener(s) and serves until ctx is cancelled, then
+// performs a graceful shutdown of all servers bounded by
+// cfg.ShutdownWait. If cfg.PreStopDelay is positive, readiness is pinned
+// to false first and the servers keep serving for that long so load
+// balancers can drain them.
+//
+// If a server has not drained within cfg.ShutdownWait, its remaining
+// connections are closed forcibly and the number dropped is logged.
+// The WithShutdownHook functions run when Run returns: after the servers
+// have stopped, or straight away if a listener could not be bound.
 //
 // Run returns nil on a clean shutdown caused by ctx cancellation, and a
-// non-nil error if either the listener could not be bound, the server
+// non-nil error if either a listener could not be bound, a server
 // terminated with an error other than http.ErrServerClosed, or the
-// shutdown itself failed.
+// shutdown itself failed (including a forced close).
+//
+// The background checks (warmup, heap guard, health command, unready
+// grace) run until Run returns, also when the shutdown was requested via
+// POST /admin/shutdown rather than by cancelling ctx.
 func (s *Server) Run(ctx context.Context) error {
-	ln, err := net.Listen("tcp", s.http.Addr)
-	if err != nil {
-		return fmt.Errorf("listen %s: %w", s.http.Addr, err)
+	defer runShutdownHooks(s.hooks, s.cfg.ShutdownHookTimeout, s.log)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if s.tracer != nil {
+		defer s.flushTracer()
+	}
+	network, addr := s.cfg.Listen()
+	var ln net.Listener
+	var err error
+	if s.cfg.ListenFD > 0 {
+		ln, err = fileListener(s.cfg.ListenFD)
+		if err != nil {
+			return err
+		}
+		network, addr = ln.Addr().Network(), ln.Addr().String()
+	} else {
+		if network == "unix" {
+			if err := removeStaleSocket(addr); err != nil {
+				return err
+			}
+			defer os.Remove(addr)
+		}
+		ln, err = s.bind(ctx, network, addr)
+		if err != nil {
+			return fmt.Errorf("listen %s %s: %w", network, addr, err)
+		}
+	}
+	if s.cfg.EnableProxyProtocol {
+		ln = proxyproto.NewListener(ln, proxyHeaderTimeout)
+	}
+	ln = newLimitListener(ln, s.cfg.MaxConnections)
+
+	var adminLn net.Listener
+	if s.admin != nil {
+		adminLn, err = s.bind(ctx, "tcp", s.admin.Addr)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("listen admin %s: %w", s.admin.Addr, err)
+		}
 	}
 
 	s.log.Info("starting",
 		"service", s.cfg.ServiceName,
 		"version", s.cfg.Version,
-		"addr", s.http.Addr,
-		"startup_delay", s.cfg.StartupDelay.String(),
+		"network", network,
+		"addr", addr,
+		"listen_fd", s.cfg.ListenFD,
+		"admin_addr", s.adminAddr(),
+		"health_startup_delay", s.cfg.HealthStartupDelay.String(),
+		"ready_startup_delay", s.cfg.ReadyStartupDelay.String(),
+		"startup_probe_delay", s.cfg.StartupProbeDelay.String(),
+		"warmup", s.warmup != nil,
+		"tls", s.cfg.TLSEnabled(),
+		"h2c", s.cfg.EnableH2C && !s.cfg.TLSEnabled(),
+		"proxy_protocol", s.cfg.EnableProxyProtocol,
+		"max_connections", s.cfg.MaxConnections,
+		"tracing", s.cfg.EnableTracing,
+		"response_delay", s.cfg.ResponseDelay.String(),
 	)
 
-	errCh := make(chan error, 1)
-	go func() {
-		err := s.http.Serve(ln)
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			errCh <- err
-			return
+	if s.warmup != nil {
+		go s.warmup.run(ctx, s.log)
+	}
+	if s.heap != nil {
+		go s.heap.run(ctx, s.log)
+	}
+	if s.command != nil {
+		go s.command.run(ctx, s.log)
+	}
+	if s.grace != nil {
+		go s.grace.run(ctx, s.log)
+	}
+
+	servers := []*http.Server{s.http}
+	if s.admin != nil {
+		servers = append(servers, s.admin)
+	}
+	conns := make(map[*http.Server]*atomic.Int64, len(servers))
+	for _, srv := range servers {
+		var connLog *slog.Logger
+		if s.cfg.LogConnState {
+			name := "main"
+			if srv == s.admin {
+				name = "admin"
+			}
+			connLog = s.log.With("listener", name)
 		}
-		errCh <- nil
-	}()
+		conns[srv] = trackConns(srv, connLog)
+	}
+
+	errCh := make(chan error, 2)
+	go s.serve(s.http, ln, errCh)
+	if s.admin != nil {
+		go s.serve(s.admin, adminLn, errCh)
+	}
 
 	select {
 	case <-ctx.Done():
 		s.log.Info("shutdown requested")
+	case <-s.stop:
+		s.log.Info("shutdown requested", "source", "admin")
 	case err := <-errCh:
-		if err != nil {
-			s.log.Error("server error", "err", err)
-			return err
+		return s.abort(servers, err)
+	}
+	s.draining.Store(true)
+	if s.cfg.DrainCloseIdle {
+		// Closes idle keep-alive connections now and every other one
+		// after its current response, instead of at the end of the drain.
+		s.SetKeepAlivesEnabled(false)
+	}
+
+	if s.cfg.PreStopDelay > 0 {
+		s.ready.Hold()
+		s.log.Info("draining", "prestop_delay", s.cfg.PreStopDelay.String())
+		select {
+		case <-time.After(s.cfg.PreStopDelay):
+		case err := <-errCh:
+			return s.abort(servers, err)
 		}
-		return nil
 	}
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownWait)
 	defer cancel()
 
-	if err := s.http.Shutdown(shutdownCtx); err != nil {
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				// Handlers did not finish within ShutdownWait: drop their
+				// connections instead of leaving them to hang.
+				dropped := conns[srv].Load()
+				_ = srv.Close()
+				s.log.Warn("forced close", "addr", srv.Addr, "dropped_connections", dropped)
+			}
+			errs = append(errs, fmt.Errorf("shutdown %s: %w", srv.Addr, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
 		s.log.Error("shutdown failed", "err", err)
-		return fmt.Errorf("shutdown: %w", err)
+		return err
 	}
 	s.log.Info("shutdown complete")
 	return nil
 }
+
+// requestShutdown makes Run start its graceful shutdown, exactly as if
+// its context had been cancelled. It is safe to call more than once.
+func (s *Server) requestShutdown() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// serve runs srv on ln (with TLS if configured) and reports the outcome
+// on errCh. http.ErrServerClosed is reported as nil.
+func (s *Server) serve(srv *http.Server, ln net.Listener, errCh chan<- error) {
+	var err error
+	if s.cfg.TLSEnabled() {
+		err = srv.ServeTLS(ln, s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errCh <- err
+		return
+	}
+	errCh <- nil
+}
+
+// abort handles a server that stopped on its own: the remaining servers
+// are closed immediately and err (which may be nil) is returned.
+func (s *Server) abort(servers []*http.Server, err error) error {
+	for _, srv := range servers {
+		_ = srv.Close()
+	}
+	if err != nil {
+		s.log.Error("server error", "err", err)
+	}
+	return err
+}
+
+// trackConns installs a ConnState hook on srv that counts its open
+// connections and returns the counter. With a non-nil log every state
+// change is logged (LOG_CONN_STATE) with a per-listener connection
+// number, the remote address and the number of open connections.
+func trackConns(srv *http.Server, log *slog.Logger) *atomic.Int64 {
+	var n atomic.Int64
+	var seq atomic.Uint64
+	var ids sync.Map // net.Conn -> *connInfo
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			n.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			n.Add(-1)
+		}
+		if log == nil {
+			return
+		}
+		var info *connInfo
+		if state == http.StateNew {
+			// The hook runs in the accept loop: take the peer address,
+			// which never blocks, rather than RemoteAddr, which waits for
+			// the PROXY protocol header.
+			info = &connInfo{id: seq.Add(1), remote: peerAddr(c)}
+			ids.Store(c, info)
+		} else if v, ok := ids.Load(c); ok {
+			info = v.(*connInfo)
+		} else {
+			return
+		}
+		if state == http.StateActive && !info.resolved {
+			info.remote, info.resolved = c.RemoteAddr().String(), true
+		}
+		if state == http.StateClosed || state == http.StateHijacked {
+			ids.Delete(c)
+		}
+		log.Info("conn state",
+			"state", state.String(),
+			"conn", info.id,
+			"remote", info.remote,
+			"open", n.Load(),
+		)
+	}
+	return &n
+}
+
+// connInfo identifies a connection in LOG_CONN_STATE lines. The hook is
+// called sequentially for any one connection, so no locking is needed.
+type connInfo struct {
+	id       uint64
+	remote   string
+	resolved bool
+}
+
+// peerAddr returns the address of c's immediate peer, unwrapping listener
+// wrappers (NetConn, as on *tls.Conn) down to the accepted socket.
+func peerAddr(c net.Conn) string {
+	for {
+		u, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return c.RemoteAddr().String()
+		}
+		c = u.NetConn()
+	}
+}
+
+// flushTracer exports the remaining spans, bounded by cfg.ShutdownWait.
+func (s *Server) flushTracer() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownWait)
+	defer cancel()
+	if err := s.tracer.Shutdown(ctx); err != nil {
+		s.log.Warn("tracing: flush incomplete", "err", err)
+	}
+}
+
+// adminAddr returns the admin listen address, or "" if admin routes are
+// served on the main listener.
+func (s *Server) adminAddr() string {
+	if s.admin == nil {
+		return ""
+	}
+	return s.admin.Addr
+}
+
+// removeStaleSocket deletes a leftover Unix socket at path, e.g. from a
+// previous process that was killed without cleaning up. It refuses to
+// delete anything that is not a socket.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("listen unix %s: path exists and is not a socket", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale socket %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,1096 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bodsch.me/probe-service/internal/config"
+	"bodsch.me/probe-service/pkg/flagx"
+)
+
+// TestRun_PreStopDrain verifies that cancelling Run's context first pins
+// readiness to false, reported as "draining", for PreStopDelay and only
+// then shuts the server down.
+func TestRun_PreStopDrain(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Config{
+		Port:         0, // ephemeral
+		ServiceName:  "probe-service-test",
+		Version:      "0.0.0-test",
+		ShutdownWait: time.Second,
+		PreStopDelay: 100 * time.Millisecond,
+		MaxBodyBytes: 1 << 16,
+	}
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	if res := do(t, srv, http.MethodGet, "/readyz"); res.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz during drain = %d, want 503", res.Code)
+	} else if body := decodeBody(t, res); body["status"] != "draining" {
+		t.Errorf("/readyz during drain: status = %v, want draining", body["status"])
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned before PreStopDelay elapsed: %v", err)
+	default:
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after drain")
+	}
+}
+
+// TestRun_Warmup verifies that readiness waits for the WarmupFunc started
+// by Run and stays down, reporting the error, when it fails.
+func TestRun_Warmup(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Config{
+		ListenNetwork: "unix",
+		ListenAddr:    filepath.Join(t.TempDir(), "probe.sock"),
+		ServiceName:   "probe-service-test",
+		Version:       "0.0.0-test",
+		ShutdownWait:  time.Second,
+		MaxBodyBytes:  1 << 16,
+	}
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+		state  string
+	}{
+		{"ok", nil, http.StatusOK, "done"},
+		{"failed", errors.New("cache unreachable"), http.StatusServiceUnavailable, "failed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			srv, err := New(cfg, log, WithWarmup(func(ctx context.Context) error {
+				<-release
+				return tc.err
+			}))
+			if err != nil {
+				t.Fatalf("server.New: %v", err)
+			}
+			if res := do(t, srv, http.MethodGet, "/readyz"); res.Code != http.StatusServiceUnavailable {
+				t.Fatalf("/readyz before warmup = %d, want 503", res.Code)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- srv.Run(ctx) }()
+			close(release)
+
+			var res *httptest.ResponseRecorder
+			for i := 0; i < 50; i++ {
+				if res = do(t, srv, http.MethodGet, "/readyz"); decodeBody(t, res)["warmup"].(map[string]any)["state"] == tc.state {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if res.Code != tc.status {
+				t.Errorf("/readyz after warmup = %d, want %d", res.Code, tc.status)
+			}
+
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+		})
+	}
+}
+
+// TestRun_UnixSocket verifies serving over a Unix socket, replacing a
+// stale socket file on start and removing the socket on shutdown.
+func TestRun_UnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "probe.sock")
+
+	// Leave a stale socket behind, as a crashed process would.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("create stale socket: %v", err)
+	}
+	// Asserted through an interface: plan9's UnixListener lacks the method.
+	if ul, ok := stale.(interface{ SetUnlinkOnClose(bool) }); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	stale.Close()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Config{
+		ListenNetwork: "unix",
+		ListenAddr:    sock,
+		ServiceName:   "probe-service-test",
+		Version:       "0.0.0-test",
+		ShutdownWait:  time.Second,
+		MaxBodyBytes:  1 << 16,
+	}
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = client.Get("http://unix/healthz"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", res.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket still present after shutdown: %v", err)
+	}
+}
+
+// TestRun_H2C verifies that with EnableH2C the listener answers both
+// prior-knowledge HTTP/2 and HTTP/1.1 clients without TLS.
+func TestRun_H2C(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "probe.sock")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Config{
+		ListenNetwork: "unix",
+		ListenAddr:    sock,
+		ServiceName:   "probe-service-test",
+		Version:       "0.0.0-test",
+		ShutdownWait:  time.Second,
+		MaxBodyBytes:  1 << 16,
+		EnableH2C:     true,
+	}
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	client := func(h2c bool) *http.Client {
+		tr := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		}
+		if h2c {
+			tr.Protocols = new(http.Protocols)
+			tr.Protocols.SetUnencryptedHTTP2(true)
+		}
+		return &http.Client{Transport: tr}
+	}
+	for _, tc := range []struct {
+		h2c   bool
+		proto int
+	}{{true, 2}, {false, 1}} {
+		var res *http.Response
+		for i := 0; i < 50; i++ {
+			if res, err = client(tc.h2c).Get("http://unix/version"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("GET (h2c=%v): %v", tc.h2c, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || res.ProtoMajor != tc.proto {
+			t.Errorf("h2c=%v: status %d over %s, want 200 over HTTP/%d", tc.h2c, res.StatusCode, res.Proto, tc.proto)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+// TestRun_ProxyProtocol verifies that with EnableProxyProtocol the client
+// address from the PROXY header becomes the request's RemoteAddr.
+func TestRun_ProxyProtocol(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "probe.sock")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Config{
+		ListenNetwork:       "unix",
+		ListenAddr:          sock,
+		ServiceName:         "probe-service-test",
+		Version:             "0.0.0-test",
+		ShutdownWait:        time.Second,
+		MaxBodyBytes:        1 << 16,
+		EnableProxyProtocol: true,
+	}
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			c, err := d.DialContext(ctx, "unix", sock)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.WriteString(c, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")
+			return c, err
+		},
+	}}
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = client.Get("http://unix/echo"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /echo: %v", err)
+	}
+	var body map[string]any
+	err = json.NewDecoder(res.Body).Decode(&body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["remote"] != "192.0.2.1:56324" {
+		t.Errorf("remote = %v, want 192.0.2.1:56324", body["remote"])
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+// TestRun_ListenFD verifies that Run serves on an inherited listening
+// socket instead of binding its own.
+func TestRun_ListenFD(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+	f, err := inner.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := New(config.Config{
+		ListenFD:     int(f.Fd()),
+		ServiceName:  "probe-service-test",
+		Version:      "0.0.0-test",
+		ShutdownWait: time.Second,
+		MaxBodyBytes: 1 << 16,
+	}, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = http.Get("http://" + inner.Addr().String() + "/version"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /version: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", res.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+// TestRun_KeepAlivesDisabled verifies that SetKeepAlivesEnabled(false)
+// makes every response close its connection.
+func TestRun_KeepAlivesDisabled(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "probe.sock")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := New(config.Config{
+		ListenNetwork: "unix",
+		ListenAddr:    sock,
+		ServiceName:   "probe-service-test",
+		Version:       "0.0.0-test",
+		ShutdownWait:  time.Second,
+		MaxBodyBytes:  1 << 16,
+	}, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	srv.SetKeepAlivesEnabled(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = client.Get("http://unix/healthz"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /healthz: %v", err)
+	}
+	res.Body.Close()
+	if !res.Close {
+		t.Error("response without Connection: close")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+// TestRun_DrainCloseIdle verifies DRAIN_CLOSE_IDLE: once shutdown begins,
+// the idle keep-alive connection is closed and responses during the
+// PreStopDelay drain carry Connection: close.
+func TestRun_DrainCloseIdle(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "probe.sock")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := New(config.Config{
+		ListenNetwork:  "unix",
+		ListenAddr:     sock,
+		ServiceName:    "probe-service-test",
+		Version:        "0.0.0-test",
+		ShutdownWait:   time.Second,
+		PreStopDelay:   200 * time.Millisecond,
+		DrainCloseIdle: true,
+		MaxBodyBytes:   1 << 16,
+	}, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	var dials atomic.Int32
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			c, err := d.DialContext(ctx, "unix", sock)
+			if err == nil {
+				dials.Add(1)
+			}
+			return c, err
+		},
+	}}
+	get := func() *http.Response {
+		t.Helper()
+		var res *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if res, err = client.Get("http://unix/livez"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("GET /livez: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		return res
+	}
+
+	if res := get(); res.Close {
+		t.Fatal("response before shutdown closed the connection")
+	}
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	if res := get(); !res.Close {
+		t.Error("response during drain without Connection: close")
+	}
+	if n := dials.Load(); n != 2 {
+		t.Errorf("dials = %d, want 2 (idle connection closed at shutdown)", n)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+// TestRun_ShutdownHooks verifies that shutdown hooks run after the server
+// has stopped, last registered first, and that a hook exceeding
+// ShutdownHookTimeout is abandoned and logged without blocking the rest.
+func TestRun_ShutdownHooks(t *testing.T) {
+	var buf lockedBuffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	var mu sync.Mutex
+	var order []string
+	hook := func(name string) ShutdownHook {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	srv, err := New(config.Config{
+		ListenNetwork:       "unix",
+		ListenAddr:          filepath.Join(t.TempDir(), "probe.sock"),
+		ServiceName:         "probe-service-test",
+		Version:             "0.0.0-test",
+		ShutdownWait:        time.Second,
+		ShutdownHookTimeout: 50 * time.Millisecond,
+		MaxBodyBytes:        1 << 16,
+	}, log,
+		WithShutdownHook(hook("first")),
+		WithShutdownHook(func(context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}),
+		WithShutdownHook(hook("last")),
+	)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Run took %v, want the slow hook abandoned after 50ms", d)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(order, ",") != "last,first" {
+		t.Errorf("hook order = %v, want [last first]", order)
+	}
+	if !strings.Contains(buf.String(), "shutdown hook failed") {
+		t.Errorf("timed out hook not logged:\n%s", buf.String())
+	}
+}
+
+// TestRun_ShutdownHooksOnBindError verifies that the shutdown hooks also
+// run when Run fails before serving because its address is in use.
+func TestRun_ShutdownHooksOnBindError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+
+	ran := false
+	srv, err := New(config.Config{
+		ListenAddr:          busy.Addr().String(),
+		ServiceName:         "probe-service-test",
+		Version:             "0.0.0-test",
+		ShutdownWait:        time.Second,
+		ShutdownHookTimeout: time.Second,
+		MaxBodyBytes:        1 << 16,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithShutdownHook(func(context.Context) error {
+			ran = true
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	if err := srv.Run(context.Background()); err == nil {
+		t.Fatal("Run on a port in use returned nil")
+	}
+	if !ran {
+		t.Error("shutdown hook did not run after the bind error")
+	}
+}
+
+// TestHeartbeat verifies that Heartbeat logs the probe states at the
+// interval and returns when ctx is done.
+func TestHeartbeat(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	srv, err := New(config.Config{
+		ServiceName:  "probe-service-test",
+		Version:      "0.0.0-test",
+		ShutdownWait: time.Second,
+		MaxBodyBytes: 1 << 16,
+	}, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+	srv.Heartbeat(ctx, 10*time.Millisecond)
+
+	out := buf.String()
+	if n := strings.Count(out, "msg=heartbeat"); n < 2 {
+		t.Fatalf("logged %d heartbeats, want several:\n%s", n, out)
+	}
+	for _, want := range []string{"health=true", "ready=true", "started=true", "goroutines="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("heartbeat lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that is safe for concurrent log writes.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestTrackConns_Log verifies the LOG_CONN_STATE lines for one keep-alive
+// connection: new, active, idle, then closed, all with the same number.
+func TestTrackConns_Log(t *testing.T) {
+	var buf lockedBuffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	open := trackConns(srv, log)
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	tr := &http.Transport{}
+	res, err := (&http.Client{Transport: tr}).Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	tr.CloseIdleConnections()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), "state=closed") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	out := buf.String()
+	for _, state := range []string{"new", "active", "idle", "closed"} {
+		if !strings.Contains(out, "state="+state+" conn=1 remote=127.0.0.1:") {
+			t.Errorf("no %s line for conn 1 in:\n%s", state, out)
+		}
+	}
+	if n := open.Load(); n != 0 {
+		t.Errorf("open connections = %d, want 0", n)
+	}
+}
+
+// TestLimitListener checks that Accept blocks at the limit until a
+// connection is closed, and returns once the listener is closed.
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := newLimitListener(inner, 1)
+
+	for range 2 {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	first, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("first Accept: %v", err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+	select {
+	case <-accepted:
+		t.Fatal("second Accept returned while at the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Close()
+	select {
+	case c, ok := <-accepted:
+		if !ok {
+			t.Fatal("second Accept failed")
+		}
+		defer c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("second Accept still blocked after a connection was closed")
+	}
+
+	// The slot is taken again: Close must unblock the waiting Accept.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ln.Close()
+	}()
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept after Close: err = %v, want net.ErrClosed", err)
+	}
+}
+
+// TestListen_ReusePort checks that two REUSEPORT listeners can bind the
+// same port while a plain listener cannot.
+func TestListen_ReusePort(t *testing.T) {
+	ctx := context.Background()
+	first, err := listen(ctx, "tcp", "127.0.0.1:0", true)
+	if err != nil {
+		t.Skipf("SO_REUSEPORT unavailable: %v", err)
+	}
+	defer first.Close()
+	addr := first.Addr().String()
+
+	second, err := listen(ctx, "tcp", addr, true)
+	if err != nil {
+		t.Fatalf("second listener with REUSEPORT: %v", err)
+	}
+	second.Close()
+
+	if plain, err := listen(ctx, "tcp", addr, false); err == nil {
+		plain.Close()
+		t.Error("listener without REUSEPORT bound a port in use")
+	}
+}
+
+// TestBind_Retry checks LISTEN_RETRY_COUNT: binding an address in use is
+// retried until it is free, and fails at once without retries.
+func TestBind_Retry(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	addr := busy.Addr().String()
+	newServer := func(retries int) *Server {
+		t.Helper()
+		srv, err := New(config.Config{
+			ListenRetryCount: retries,
+			ListenRetryDelay: 20 * time.Millisecond,
+			ServiceName:      "probe-service-test",
+			Version:          "0.0.0-test",
+			ShutdownWait:     time.Second,
+			MaxBodyBytes:     1 << 16,
+		}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		if err != nil {
+			t.Fatalf("server.New: %v", err)
+		}
+		return srv
+	}
+
+	if _, err := newServer(0).bind(context.Background(), "tcp", addr); !addrInUse(err) {
+		t.Fatalf("bind without retries: err = %v, want address in use", err)
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		busy.Close()
+	}()
+	ln, err := newServer(5).bind(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("bind with retries: %v", err)
+	}
+	ln.Close()
+}
+
+// TestNextRetryDelay checks that the bind retry delay doubles up to
+// maxListenRetryDelay and that a larger configured delay is kept.
+func TestNextRetryDelay(t *testing.T) {
+	cases := []struct{ in, want time.Duration }{
+		{time.Second, 2 * time.Second},
+		{20 * time.Second, maxListenRetryDelay},
+		{maxListenRetryDelay, maxListenRetryDelay},
+		{time.Minute, time.Minute},
+	}
+	for _, tc := range cases {
+		if got := nextRetryDelay(tc.in); got != tc.want {
+			t.Errorf("nextRetryDelay(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+// TestUnreadyGrace checks HEALTH_GRACE_AFTER_UNREADY: readiness that is
+// not up yet leaves liveness alone, a loss longer than the grace period
+// holds it.
+func TestUnreadyGrace(t *testing.T) {
+	health := flagx.NewDelayedFlag(0)
+	ready := flagx.NewDelayedFlag(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go newUnreadyGrace(50*time.Millisecond, health, ready).run(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	time.Sleep(150 * time.Millisecond)
+	if health.Held() {
+		t.Fatal("health held while readiness was still starting")
+	}
+
+	ready.Set(true)
+	time.Sleep(30 * time.Millisecond)
+	ready.Set(false)
+	time.Sleep(20 * time.Millisecond)
+	if health.Held() {
+		t.Fatal("health held before the grace period ended")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !health.Held() {
+		if time.Now().After(deadline) {
+			t.Fatal("health not held after readiness was lost for the grace period")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRun_ForcedCloseAfterShutdownWait verifies that a request still
+// running when ShutdownWait expires is cut off and Run returns instead of
+// waiting for the handler.
+func TestRun_ForcedCloseAfterShutdownWait(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "probe.sock")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Config{
+		ListenNetwork:    "unix",
+		ListenAddr:       sock,
+		ServiceName:      "probe-service-test",
+		Version:          "0.0.0-test",
+		ShutdownWait:     100 * time.Millisecond,
+		MaxBodyBytes:     1 << 16,
+		ResponseDelayMax: time.Minute,
+	}
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	reqErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < 50; i++ {
+			if _, err := os.Stat(sock); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		res, err := client.Get("http://unix/version?delay=1m")
+		if err == nil {
+			res.Body.Close()
+		}
+		reqErr <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond) // request is now stuck in the delay
+	start := time.Now()
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Run error = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after ShutdownWait")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("shutdown took %v, want about ShutdownWait", took)
+	}
+	if err := <-reqErr; err == nil {
+		t.Error("hanging request completed normally, want connection error")
+	}
+}
+
+// TestRun_RemoteShutdown verifies that POST /admin/shutdown answers 200
+// and then makes Run return cleanly, and that the route is absent unless
+// enabled.
+func TestRun_RemoteShutdown(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	disabled, err := New(config.Config{ShutdownWait: time.Second, MaxBodyBytes: 1 << 16}, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	if res := do(t, disabled, http.MethodPost, "/admin/shutdown"); res.Code != http.StatusNotFound {
+		t.Fatalf("/admin/shutdown without ENABLE_REMOTE_SHUTDOWN = %d, want 404", res.Code)
+	}
+
+	sock := filepath.Join(t.TempDir(), "probe.sock")
+	cfg := config.Config{
+		ListenNetwork:        "unix",
+		ListenAddr:           sock,
+		ServiceName:          "probe-service-test",
+		Version:              "0.0.0-test",
+		ShutdownWait:         time.Second,
+		MaxBodyBytes:         1 << 16,
+		EnableRemoteShutdown: true,
+	}
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(context.Background()) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = client.Post("http://unix/admin/shutdown", "", nil); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("POST /admin/shutdown: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", res.StatusCode)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after /admin/shutdown")
+	}
+}
+
+// TestRemoveStaleSocket_RefusesRegularFile ensures a non-socket file at
+// the configured path is never deleted.
+func TestRemoveStaleSocket_RefusesRegularFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(p, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(p); err == nil {
+		t.Fatal("removeStaleSocket on regular file returned nil error")
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Errorf("regular file was removed: %v", err)
+	}
+}
+
+// testCert creates a certificate from tmpl signed by parent (self-signed
+// if parent is nil) and returns it with its key.
+func testCert(t *testing.T, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// TestAdminClientCert verifies TLS_CLIENT_CA: the admin listener rejects
+// clients without a certificate from the CA, the main listener does not
+// ask for one.
+func TestAdminClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "probe-test-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	serverCert, serverKey := testCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	clientCert, clientKey := testCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "admin"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	writePEM := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keyDER, err := x509.MarshalECPrivateKey(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(config.Config{
+		Port:         1,
+		AdminPort:    2,
+		TLSCertFile:  writePEM("server.pem", "CERTIFICATE", serverCert.Raw),
+		TLSKeyFile:   writePEM("server-key.pem", "EC PRIVATE KEY", keyDER),
+		TLSClientCA:  writePEM("ca.pem", "CERTIFICATE", ca.Raw),
+		ServiceName:  "probe-service-test",
+		Version:      "0.0.0-test",
+		ShutdownWait: time.Second,
+		MaxBodyBytes: 1 << 16,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	errCh := make(chan error, 2)
+	start := func(hs *http.Server) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.serve(hs, ln, errCh)
+		t.Cleanup(func() { hs.Close() })
+		return "https://" + ln.Addr().String()
+	}
+	mainURL, adminURL := start(srv.http), start(srv.admin)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	// TLS 1.2 makes the server reject a missing client certificate during
+	// the handshake; under TLS 1.3 the rejection only surfaces on the
+	// first read.
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, MaxVersion: tls.VersionTLS12},
+		}}
+	}
+	withCert := tls.Certificate{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}
+
+	if res, err := client().Get(adminURL + "/admin/status"); err == nil {
+		res.Body.Close()
+		t.Errorf("admin without client certificate: status = %d, want handshake failure", res.StatusCode)
+	}
+	res, err := client(withCert).Get(adminURL + "/admin/status")
+	if err != nil {
+		t.Fatalf("admin with client certificate: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("admin with client certificate: status = %d, want 200", res.StatusCode)
+	}
+	res, err = client().Get(mainURL + "/healthz")
+	if err != nil {
+		t.Fatalf("main without client certificate: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("main without client certificate: status = %d, want 200", res.StatusCode)
+	}
+}
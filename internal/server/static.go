@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// staticPrefix is the URL path STATIC_DIR is served under.
+const staticPrefix = "/static"
+
+// staticHandler serves the files below dir (STATIC_DIR) with
+// http.FileServer, for a small status page or documentation next to the
+// probes. It adds what FileServer leaves out:
+//
+//   - Cache-Control: "public, max-age=<maxAge>", or "no-cache" for a
+//     zero maxAge, so clients revalidate every time.
+//   - ETag: derived from modification time and size, which makes
+//     FileServer answer If-None-Match with 304.
+//   - Precompressed assets: if the client accepts gzip and "<file>.gz"
+//     exists next to the requested file, that is sent with
+//     Content-Encoding: gzip and the original file's Content-Type.
+//
+// The handler expects staticPrefix already stripped from the path.
+func staticHandler(dir string, maxAge time.Duration) http.Handler {
+	root := http.Dir(dir)
+	files := http.FileServer(root)
+	cacheControl := "no-cache"
+	if maxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Add("Vary", "Accept-Encoding")
+		name := path.Clean("/" + r.URL.Path)
+		if httpx.AcceptsEncoding(r, "gzip") && serveGzipped(w, r, root, name) {
+			return
+		}
+		if fi, err := statFile(root, name); err == nil {
+			w.Header().Set("ETag", staticETag(fi, ""))
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// serveGzipped sends name+".gz" from root if it is a regular file and
+// reports whether it did.
+func serveGzipped(w http.ResponseWriter, r *http.Request, root http.FileSystem, name string) bool {
+	f, err := root.Open(name + ".gz")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Set("ETag", staticETag(fi, "-gz"))
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+	return true
+}
+
+// statFile returns the FileInfo of name in root if it is a regular file.
+func statFile(root http.FileSystem, name string) (fs.FileInfo, error) {
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fs.ErrNotExist
+	}
+	return fi, nil
+}
+
+// staticETag builds a strong ETag from the modification time and size of
+// fi, like nginx. suffix tells encodings of the same file apart.
+func staticETag(fi fs.FileInfo, suffix string) string {
+	return fmt.Sprintf(`"%x-%x%s"`, fi.ModTime().Unix(), fi.Size(), suffix)
+}
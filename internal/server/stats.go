@@ -0,0 +1,106 @@
+package server
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// requestStats counts requests per route pattern and per status class
+// for GET /admin/stats, a lightweight alternative to /metrics for
+// environments without a scraper. It is safe for concurrent use.
+type requestStats struct {
+	mu      sync.Mutex
+	since   time.Time
+	total   uint64
+	paths   map[string]uint64
+	classes map[string]uint64
+}
+
+// newRequestStats returns empty counters starting now.
+func newRequestStats() *requestStats {
+	return &requestStats{since: time.Now(), paths: map[string]uint64{}, classes: map[string]uint64{}}
+}
+
+// Middleware counts every request once it has been served. Like the
+// metrics middleware it reads r.Pattern after routing, so it must sit
+// outside the mux with nothing in between replacing *http.Request.
+func (s *requestStats) Middleware() httpx.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := httpx.NewStatusWriter(w)
+			next.ServeHTTP(sw, r)
+
+			path := r.Pattern
+			if path == "" {
+				path = "unmatched"
+			}
+			class := strconv.Itoa(sw.Status()/100) + "xx"
+			s.mu.Lock()
+			s.total++
+			s.paths[path]++
+			s.classes[class]++
+			s.mu.Unlock()
+		})
+	}
+}
+
+// snapshot returns the counters, with "since" in tf, and clears them if
+// reset is set.
+func (s *requestStats) snapshot(reset bool, tf httpx.TimeFormat) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body := map[string]any{
+		"since":          tf.Format(s.since),
+		"total":          s.total,
+		"paths":          maps.Clone(s.paths),
+		"status_classes": maps.Clone(s.classes),
+	}
+	if reset {
+		s.since, s.total = time.Now(), 0
+		clear(s.paths)
+		clear(s.classes)
+	}
+	return body
+}
+
+// statsHandler builds a GET-only handler that reports the request
+// counters since startup (or the last reset) together with the current
+// probe states. With ?reset=true the counters are cleared after they
+// have been reported.
+//
+//	{
+//	  "requests": {"since": "<RFC3339>", "total": <int>,
+//	               "paths": {<pattern>: <int>}, "status_classes": {"2xx": <int>, ...}},
+//	  "health":   <bool>,
+//	  "ready":    <bool>,
+//	  "startup":  <bool>,
+//	  "time":     "<RFC3339>"
+//	}
+func statsHandler(stats *requestStats, targets ...flagTarget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpx.RequireMethod(w, r, http.MethodGet) {
+			return
+		}
+		reset := false
+		if v := r.URL.Query().Get("reset"); v != "" {
+			var err error
+			if reset, err = strconv.ParseBool(v); err != nil {
+				httpx.WriteError(w, r, http.StatusBadRequest, "invalid_reset")
+				return
+			}
+		}
+		body := map[string]any{
+			"requests": stats.snapshot(reset, httpx.TimeFormatFromContext(r.Context())),
+			"time":     httpx.Timestamp(r),
+		}
+		for _, t := range targets {
+			body[t.stateKey] = t.flag.Load()
+		}
+		httpx.WriteJSON(w, http.StatusOK, body)
+	}
+}
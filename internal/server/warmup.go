@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"bodsch.me/probe-service/internal/config"
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// WarmupFunc performs startup work (cache warming, connection pools, ...)
+// that must finish before the service reports ready. It should return
+// promptly once ctx is cancelled.
+type WarmupFunc func(ctx context.Context) error
+
+// Option customises a Server built by New.
+type Option func(*options)
+
+// options collects the values set by Option functions.
+type options struct {
+	warmup     WarmupFunc
+	started    time.Time
+	hooks      []ShutdownHook
+	middleware []httpx.Middleware
+}
+
+// WithWarmup gates readiness on fn: Run starts it in a goroutine once the
+// listeners are bound, and readiness stays 503 until it has returned nil.
+// If it fails, readiness stays 503 and reports the error. It replaces the
+// sleep configured by WARMUP_DURATION.
+func WithWarmup(fn WarmupFunc) Option {
+	return func(o *options) { o.warmup = fn }
+}
+
+// WithStartTime sets the process start time reported as "started_at" by
+// the probes and /info, and from which uptime is measured. Without it
+// the time New is called is used.
+func WithStartTime(t time.Time) Option {
+	return func(o *options) { o.started = t }
+}
+
+// sleepWarmup is the WarmupFunc behind WARMUP_DURATION.
+func sleepWarmup(d time.Duration) WarmupFunc {
+	return func(ctx context.Context) error {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			return nil
+		}
+	}
+}
+
+// warmup tracks the progress of a WarmupFunc for the readiness probe.
+type warmup struct {
+	fn WarmupFunc
+
+	mu       sync.Mutex
+	state    string // "pending", "running", "done" or "failed"
+	err      error
+	duration time.Duration
+}
+
+// newWarmup returns the warmup selected by o and cfg, or nil if there is
+// none.
+func newWarmup(cfg config.Config, o options) *warmup {
+	fn := o.warmup
+	if fn == nil && cfg.WarmupDuration > 0 {
+		fn = sleepWarmup(cfg.WarmupDuration)
+	}
+	if fn == nil {
+		return nil
+	}
+	return &warmup{fn: fn, state: "pending"}
+}
+
+// run executes the WarmupFunc and records its outcome. It is called once,
+// from Run.
+func (w *warmup) run(ctx context.Context, log *slog.Logger) {
+	w.mu.Lock()
+	w.state = "running"
+	w.mu.Unlock()
+
+	start := time.Now()
+	err := w.fn(ctx)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.duration = time.Since(start)
+	if err != nil {
+		w.state, w.err = "failed", err
+		log.Error("warmup failed, readiness stays down", "err", err, "duration", w.duration.String())
+		return
+	}
+	w.state = "done"
+	log.Info("warmup complete", "duration", w.duration.String())
+}
+
+// status reports whether warmup has succeeded, together with its state
+// for probe responses:
+//
+//	{"state": "pending|running|done|failed", "duration_ms": <once finished>, "error": "<on failure>"}
+func (w *warmup) status() (done bool, body map[string]any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	body = map[string]any{"state": w.state}
+	if w.state == "done" || w.state == "failed" {
+		body["duration_ms"] = w.duration.Milliseconds()
+	}
+	if w.err != nil {
+		body["error"] = w.err.Error()
+	}
+	return w.state == "done", body
+}
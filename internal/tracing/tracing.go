@@ -0,0 +1,270 @@
+// Package tracing implements just enough distributed tracing for the
+// probe service: W3C traceparent propagation, one server span per
+// request, and a batching exporter that speaks OTLP/HTTP with JSON
+// encoding. It avoids the OpenTelemetry SDK to keep the module free of
+// third-party dependencies; any OTLP-compatible collector can receive the
+// spans.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+const (
+	// queueSize bounds the number of finished spans waiting for export.
+	// Spans beyond it are dropped rather than blocking requests.
+	queueSize = 2048
+	// batchSize is the maximum number of spans per export request.
+	batchSize = 512
+	// flushInterval is how often a partial batch is exported.
+	flushInterval = 5 * time.Second
+)
+
+// span is a finished server span.
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // zero if the request carried no traceparent
+	name     string
+	start    time.Time
+	end      time.Time
+	method   string
+	path     string
+	status   int
+}
+
+// Tracer records server spans and exports them in the background. Create
+// it with New and stop it with Shutdown.
+type Tracer struct {
+	service  string
+	endpoint string
+	client   *http.Client
+	log      *slog.Logger
+
+	queue   chan span
+	stop    chan struct{}
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// New starts a Tracer that exports to the OTLP/HTTP endpoint (the base
+// URL, e.g. http://collector:4318; "/v1/traces" is appended) and reports
+// spans under the given service name.
+func New(service, endpoint string, log *slog.Logger) *Tracer {
+	t := &Tracer{
+		service:  service,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		client:   &http.Client{Timeout: 10 * time.Second},
+		log:      log,
+		queue:    make(chan span, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Middleware starts a server span for every request. If the request
+// carries a valid W3C traceparent header the span joins that trace;
+// otherwise a new trace is started. The trace ID is stored in the request
+// context (see httpx.TraceIDFromContext) so the access log can include it.
+//
+// The span is named after the matched ServeMux pattern, so no middleware
+// between this one and the mux may replace *http.Request.
+func (t *Tracer) Middleware() httpx.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := span{start: time.Now(), method: r.Method, path: r.URL.Path}
+			if tid, pid, ok := ParseTraceparent(r.Header.Get("Traceparent")); ok {
+				s.traceID, s.parentID = tid, pid
+			} else {
+				_, _ = rand.Read(s.traceID[:])
+			}
+			_, _ = rand.Read(s.spanID[:])
+
+			r = r.WithContext(httpx.WithTraceID(r.Context(), hex.EncodeToString(s.traceID[:])))
+			sw := httpx.NewStatusWriter(w)
+			next.ServeHTTP(sw, r)
+
+			s.end = time.Now()
+			s.status = sw.Status()
+			s.name = r.Method + " " + r.URL.Path
+			if r.Pattern != "" {
+				s.name = r.Pattern
+				if !strings.Contains(r.Pattern, " ") {
+					s.name = r.Method + " " + r.Pattern
+				}
+			}
+			select {
+			case t.queue <- s:
+			default:
+				t.dropped.Add(1)
+			}
+		})
+	}
+}
+
+// Shutdown exports all queued spans and stops the background exporter.
+// It returns ctx.Err() if ctx ends first. Spans recorded after Shutdown
+// are discarded.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+	select {
+	case <-t.done:
+		if n := t.dropped.Load(); n > 0 {
+			t.log.Warn("tracing: spans dropped", "count", n)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run batches spans from the queue and exports them until Shutdown.
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []span
+	flush := func() {
+		if len(batch) > 0 {
+			t.export(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			if batch = append(batch, s); len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.queue:
+					if batch = append(batch, s); len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export sends one batch. Failures are logged and the batch is dropped;
+// tracing must never affect request handling.
+func (t *Tracer) export(batch []span) {
+	body, err := json.Marshal(t.payload(batch))
+	if err != nil {
+		t.log.Error("tracing: encode spans", "err", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		t.log.Error("tracing: build export request", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(req)
+	if err != nil {
+		t.log.Warn("tracing: export failed", "spans", len(batch), "err", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		t.log.Warn("tracing: export rejected", "spans", len(batch), "status", res.StatusCode)
+	}
+}
+
+// payload renders batch as an OTLP ExportTraceServiceRequest in the
+// protobuf JSON mapping.
+func (t *Tracer) payload(batch []span) map[string]any {
+	spans := make([]map[string]any, len(batch))
+	for i, s := range batch {
+		m := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              2, // SPAN_KIND_SERVER
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes": []map[string]any{
+				stringAttr("http.request.method", s.method),
+				stringAttr("url.path", s.path),
+				{"key": "http.response.status_code", "value": map[string]any{"intValue": strconv.Itoa(s.status)}},
+			},
+		}
+		if s.parentID != [8]byte{} {
+			m["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.status >= 500 {
+			m["status"] = map[string]any{"code": 2} // STATUS_CODE_ERROR
+		}
+		spans[i] = m
+	}
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{
+				"attributes": []map[string]any{stringAttr("service.name", t.service)},
+			},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": "bodsch.me/probe-service/internal/tracing"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// stringAttr builds an OTLP KeyValue with a string value.
+func stringAttr(key, val string) map[string]any {
+	return map[string]any{"key": key, "value": map[string]any{"stringValue": val}}
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+// ("00-<trace-id>-<parent-id>-<flags>"). It returns ok=false for
+// malformed values, the invalid version ff, and all-zero IDs.
+func ParseTraceparent(v string) (traceID [16]byte, parentID [8]byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.DecodeString(parts[3]); err != nil {
+		return traceID, parentID, false
+	}
+	if traceID == [16]byte{} || parentID == [8]byte{} {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, true
+}
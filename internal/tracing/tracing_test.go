@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// TestParseTraceparent checks valid headers and the rejection rules.
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		in string
+		ok bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", true},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false},
+		{"garbage", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		if _, _, ok := ParseTraceparent(tc.in); ok != tc.ok {
+			t.Errorf("ParseTraceparent(%q) ok = %v, want %v", tc.in, ok, tc.ok)
+		}
+	}
+}
+
+// TestTracer_ExportsSpanOnShutdown verifies that a request joins the
+// inbound trace, exposes the trace ID in its context, and that Shutdown
+// flushes the span to the collector in OTLP JSON form.
+func TestTracer_ExportsSpanOnShutdown(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []map[string]any
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("export path = %q, want /v1/traces", r.URL.Path)
+		}
+		var m map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		mu.Lock()
+		payloads = append(payloads, m)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	tr := New("probe-service-test", collector.URL, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var gotTraceID string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		gotTraceID = httpx.TraceIDFromContext(r.Context())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	h := tr.Middleware()(mux)
+
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	r.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if gotTraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID in context = %q, want the inbound one", gotTraceID)
+	}
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(payloads) != 1 {
+		t.Fatalf("got %d exports, want 1", len(payloads))
+	}
+	rs := payloads[0]["resourceSpans"].([]any)[0].(map[string]any)
+	span := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	if span["name"] != "GET /healthz" || span["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Errorf("span = %v", span)
+	}
+	if status, _ := span["status"].(map[string]any); status["code"] != float64(2) {
+		t.Errorf("span status = %v, want error for 503", span["status"])
+	}
+}
@@ -0,0 +1,345 @@
+// Package flagx provides small concurrency primitives used by the probe
+// service. The central type is DelayedFlag, a boolean state that becomes
+// true only after a configured delay and can be reset safely from any
+// goroutine.
+//
+// The package depends only on the standard library and can be imported
+// by other services that want delayed liveness/readiness semantics.
+package flagx
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DelayedFlag is a boolean state that becomes true after a configured
+// delay. It is safe for concurrent use.
+//
+// The flag distinguishes between three logical states:
+//   - false, expiring at time T  → Load() returns false; Remaining()>0
+//   - false, never expires       → Load() returns false; Remaining()==0
+//     (after Set(false), or transiently between Reset and timer start)
+//   - true                       → Load() returns true; Remaining()==0
+//
+// Reset() can be called any number of times. A generation counter
+// guarded by the same mutex as the timer callback prevents stale timers
+// from flipping the flag after a fresh Reset.
+//
+// Hold() puts the flag into a sticky false state: Reset() becomes a no-op
+// until the hold is cleared by Release() or Set().
+//
+// With WithTTL the flag cycles: after being true for the TTL it flips
+// back to false and re-arms the delay, indefinitely. The TTL timer
+// belongs to the same generation as the delay timer, so Reset, Set and
+// Hold cancel a pending TTL expiry just like a pending delay.
+//
+// With WithJitter every arm with the configured delay (construction,
+// Reset, Release and TTL cycles) waits a random duration in
+// [delay, delay+jitter] instead, so that replicas started together do not
+// flip in lockstep. EffectiveDelay reports the duration last chosen.
+type DelayedFlag struct {
+	delay  time.Duration
+	ttl    time.Duration
+	jitter time.Duration
+	script Script
+
+	// val is read lock-free on the hot path (Load).
+	val atomic.Bool
+	// held is true while the flag is pinned to false by Hold. It is only
+	// written under mu but read lock-free by Held().
+	held atomic.Bool
+	// deadline carries the timer expiry in UnixNano; 0 means "no pending timer".
+	// It is read lock-free by Remaining() to avoid contention with frequent
+	// HTTP probes.
+	deadline atomic.Int64
+	// ttlDeadline carries the TTL expiry in UnixNano while the flag is true
+	// and a TTL is configured; 0 otherwise.
+	ttlDeadline atomic.Int64
+	// cycles counts completed true→false transitions caused by the TTL.
+	cycles atomic.Uint64
+	// effective is the delay applied by the latest arm, in nanoseconds.
+	effective atomic.Int64
+
+	// mu protects gen and timer, and serialises Reset with the timer callback
+	// so that a stale callback cannot overwrite val.
+	mu    sync.Mutex
+	gen   uint64
+	timer *time.Timer
+	// rnd draws the jitter; it is seeded per flag and guarded by mu.
+	rnd *rand.Rand
+}
+
+// Option configures optional DelayedFlag behaviour.
+type Option func(*DelayedFlag)
+
+// WithTTL makes the flag flip back to false ttl after it became true and
+// then re-arm its delay, cycling indefinitely. A non-positive ttl keeps
+// the flag true once it flipped (the default).
+func WithTTL(ttl time.Duration) Option {
+	return func(f *DelayedFlag) { f.ttl = ttl }
+}
+
+// WithScript replaces the delay (and TTL) with script: every arm (the
+// initial one, Reset, Release and the *With variants) runs the script
+// from its first step. Set and Hold stop it like a pending delay. An
+// empty script keeps the delay behaviour.
+func WithScript(script Script) Option {
+	return func(f *DelayedFlag) { f.script = script }
+}
+
+// WithJitter spreads the configured delay over [delay, delay+jitter],
+// drawn anew on every arm that uses it. ResetWith and ReleaseWith apply
+// their explicit delay exactly, and a non-positive delay stays immediate.
+// A non-positive jitter keeps exact timing (the default).
+func WithJitter(jitter time.Duration) Option {
+	return func(f *DelayedFlag) { f.jitter = jitter }
+}
+
+// NewDelayedFlag creates a DelayedFlag, sets it to false, and immediately
+// schedules it to flip to true after delay. A non-positive delay makes the
+// flag true at construction time.
+func NewDelayedFlag(delay time.Duration, opts ...Option) *DelayedFlag {
+	f := &DelayedFlag{delay: delay}
+	for _, o := range opts {
+		o(f)
+	}
+	if f.jitter > 0 {
+		f.rnd = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	f.Reset()
+	return f
+}
+
+// Load returns the current boolean state without acquiring a lock.
+func (f *DelayedFlag) Load() bool { return f.val.Load() }
+
+// Delay returns the delay configured at construction time.
+func (f *DelayedFlag) Delay() time.Duration { return f.delay }
+
+// EffectiveDelay returns the delay applied by the most recent arm: the
+// configured delay plus the drawn jitter, or the explicit delay of
+// ResetWith/ReleaseWith.
+func (f *DelayedFlag) EffectiveDelay() time.Duration {
+	return time.Duration(f.effective.Load())
+}
+
+// TTL returns the configured TTL (0 if the flag does not cycle).
+func (f *DelayedFlag) TTL() time.Duration { return f.ttl }
+
+// Cycles returns how many times the TTL has flipped the flag back to false.
+func (f *DelayedFlag) Cycles() uint64 { return f.cycles.Load() }
+
+// Held reports whether the flag is currently pinned to false by Hold.
+func (f *DelayedFlag) Held() bool { return f.held.Load() }
+
+// Reset sets the flag to false and schedules it to flip to true after
+// the configured delay (plus jitter, see WithJitter). Concurrent calls
+// and a concurrent timer expiry cannot leave the flag in an inconsistent
+// state: the latest Reset wins. Reset does nothing while the flag is
+// held.
+func (f *DelayedFlag) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.held.Load() {
+		return
+	}
+	f.arm(f.jittered())
+}
+
+// ResetWith is like Reset but arms the flag with delay instead of the
+// configured delay, for this reset only: Delay is unchanged, and TTL
+// cycles re-arm with the configured delay again.
+func (f *DelayedFlag) ResetWith(delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.held.Load() {
+		return
+	}
+	f.arm(delay)
+}
+
+// Release clears a Hold (if any) and re-arms the flag exactly like Reset.
+func (f *DelayedFlag) Release() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.held.Store(false)
+	f.arm(f.jittered())
+}
+
+// ReleaseWith clears a Hold (if any) and re-arms the flag like ResetWith.
+func (f *DelayedFlag) ReleaseWith(delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.held.Store(false)
+	f.arm(delay)
+}
+
+// jittered returns the configured delay with a random jitter added. The
+// caller must hold f.mu.
+func (f *DelayedFlag) jittered() time.Duration {
+	if f.rnd == nil || f.delay <= 0 {
+		return f.delay
+	}
+	return f.delay + time.Duration(f.rnd.Int64N(int64(f.jitter)+1))
+}
+
+// arm sets the flag to false and starts a new timer for delay. The caller
+// must hold f.mu.
+func (f *DelayedFlag) arm(delay time.Duration) {
+	f.gen++
+	g := f.gen
+	f.val.Store(false)
+	f.effective.Store(int64(delay))
+
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.ttlDeadline.Store(0)
+
+	if len(f.script.Steps) > 0 {
+		f.step(g, 0)
+		return
+	}
+	if delay <= 0 {
+		f.deadline.Store(0)
+		f.val.Store(true)
+		f.scheduleTTL(g)
+		return
+	}
+
+	f.deadline.Store(time.Now().Add(delay).UnixNano())
+	f.timer = time.AfterFunc(delay, func() { f.expire(g) })
+}
+
+// Set forces the flag to v immediately and clears any Hold. Any pending
+// timer is stopped and the generation is bumped so that a stale callback
+// cannot override v. The flag stays at v until the next Reset (or Set).
+func (f *DelayedFlag) Set(v bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.held.Store(false)
+	f.pin(v)
+}
+
+// Hold forces the flag to false and keeps it there: Reset becomes a
+// no-op and Remaining returns 0 until Release or Set is called.
+func (f *DelayedFlag) Hold() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.held.Store(true)
+	f.pin(false)
+}
+
+// pin stops any pending timer, bumps the generation and stores v with no
+// deadline. The caller must hold f.mu.
+func (f *DelayedFlag) pin(v bool) {
+	f.gen++
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.deadline.Store(0)
+	f.ttlDeadline.Store(0)
+	f.val.Store(v)
+}
+
+// expire is the timer callback. It only flips val to true if the
+// generation it was scheduled under is still current; otherwise it is
+// the leftover of a stopped/superseded timer and must do nothing.
+func (f *DelayedFlag) expire(g uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.gen != g {
+		return
+	}
+	f.val.Store(true)
+	f.deadline.Store(0)
+	f.scheduleTTL(g)
+}
+
+// scheduleTTL starts the TTL timer for generation g if a TTL is
+// configured. The caller must hold f.mu and have just set val to true.
+func (f *DelayedFlag) scheduleTTL(g uint64) {
+	if f.ttl <= 0 {
+		return
+	}
+	f.ttlDeadline.Store(time.Now().Add(f.ttl).UnixNano())
+	f.timer = time.AfterFunc(f.ttl, func() { f.expireTTL(g) })
+}
+
+// expireTTL is the TTL timer callback: if generation g is still current
+// it flips the flag back to false and re-arms the delay.
+func (f *DelayedFlag) expireTTL(g uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.gen != g {
+		return
+	}
+	f.cycles.Add(1)
+	f.arm(f.jittered())
+}
+
+// step enters script step i under generation g and schedules the next
+// one. After the last step the script starts over if it loops and
+// otherwise keeps the last state. The caller must hold f.mu.
+func (f *DelayedFlag) step(g uint64, i int) {
+	s := f.script.Steps[i]
+	f.val.Store(s.Up)
+	next := i + 1
+	if next == len(f.script.Steps) {
+		if !f.script.Loop {
+			f.deadline.Store(0)
+			return
+		}
+		next = 0
+	}
+	f.deadline.Store(0)
+	if !s.Up && f.script.Steps[next].Up {
+		f.deadline.Store(time.Now().Add(s.Duration).UnixNano())
+	}
+	f.timer = time.AfterFunc(s.Duration, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.gen != g {
+			return
+		}
+		f.step(g, next)
+	})
+}
+
+// Remaining returns the time left until the flag flips to true.
+// It returns 0 when the flag is already true or when no timer is pending.
+func (f *DelayedFlag) Remaining() time.Duration {
+	dl := f.deadline.Load()
+	if dl <= 0 {
+		return 0
+	}
+	rem := time.Until(time.Unix(0, dl))
+	if rem < 0 {
+		return 0
+	}
+	return rem
+}
+
+// TTLRemaining returns the time left until a cycling flag flips back to
+// false. It returns 0 when no TTL is configured or the flag is false.
+func (f *DelayedFlag) TTLRemaining() time.Duration {
+	dl := f.ttlDeadline.Load()
+	if dl <= 0 {
+		return 0
+	}
+	rem := time.Until(time.Unix(0, dl))
+	if rem < 0 {
+		return 0
+	}
+	return rem
+}
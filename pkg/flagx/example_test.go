@@ -0,0 +1,25 @@
+package flagx_test
+
+import (
+	"fmt"
+	"time"
+
+	"bodsch.me/probe-service/pkg/flagx"
+)
+
+// ExampleDelayedFlag shows the basic lifecycle: false during the delay,
+// true afterwards, and false again after Reset.
+func ExampleDelayedFlag() {
+	ready := flagx.NewDelayedFlag(10 * time.Millisecond)
+	fmt.Println(ready.Load())
+
+	time.Sleep(50 * time.Millisecond)
+	fmt.Println(ready.Load())
+
+	ready.Reset()
+	fmt.Println(ready.Load())
+	// Output:
+	// false
+	// true
+	// false
+}
@@ -0,0 +1,74 @@
+package flagx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Step is one phase of a Script: the flag is Up (or not) for Duration.
+type Step struct {
+	Up       bool
+	Duration time.Duration
+}
+
+// Script is a sequence of steps driving a DelayedFlag (see WithScript).
+// With Loop the sequence repeats forever; otherwise the flag keeps the
+// state of the last step, whose Duration is then irrelevant.
+type Script struct {
+	Steps []Step
+	Loop  bool
+}
+
+// ParseScript parses a comma-separated script such as
+// "ok:10s,fail:5s,loop": each step is "ok" or "fail", a colon and a
+// positive Go duration, and an optional final "loop" repeats the
+// sequence. An empty string yields an empty Script.
+func ParseScript(s string) (Script, error) {
+	var sc Script
+	if strings.TrimSpace(s) == "" {
+		return sc, nil
+	}
+	parts := strings.Split(s, ",")
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "loop" && i == len(parts)-1 && i > 0 {
+			sc.Loop = true
+			break
+		}
+		state, dur, ok := strings.Cut(p, ":")
+		if !ok {
+			return Script{}, fmt.Errorf("step %q: expected ok:<duration> or fail:<duration>", p)
+		}
+		var up bool
+		switch strings.TrimSpace(state) {
+		case "ok":
+			up = true
+		case "fail":
+		default:
+			return Script{}, fmt.Errorf("step %q: state must be ok or fail", p)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(dur))
+		if err != nil || d <= 0 {
+			return Script{}, fmt.Errorf("step %q: duration must be positive", p)
+		}
+		sc.Steps = append(sc.Steps, Step{Up: up, Duration: d})
+	}
+	return sc, nil
+}
+
+// String renders the script in the syntax accepted by ParseScript.
+func (s Script) String() string {
+	parts := make([]string, 0, len(s.Steps)+1)
+	for _, st := range s.Steps {
+		state := "fail"
+		if st.Up {
+			state = "ok"
+		}
+		parts = append(parts, state+":"+st.Duration.String())
+	}
+	if s.Loop {
+		parts = append(parts, "loop")
+	}
+	return strings.Join(parts, ",")
+}
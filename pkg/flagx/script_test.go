@@ -0,0 +1,85 @@
+package flagx
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseScript covers valid scripts, their String round trip and the
+// rejected forms.
+func TestParseScript(t *testing.T) {
+	sc, err := ParseScript(" ok:10s, fail:500ms ,loop")
+	if err != nil {
+		t.Fatalf("ParseScript: %v", err)
+	}
+	want := []Step{{true, 10 * time.Second}, {false, 500 * time.Millisecond}}
+	if len(sc.Steps) != 2 || sc.Steps[0] != want[0] || sc.Steps[1] != want[1] || !sc.Loop {
+		t.Errorf("ParseScript = %+v, want %v with loop", sc, want)
+	}
+	if got := sc.String(); got != "ok:10s,fail:500ms,loop" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if sc, err := ParseScript(""); err != nil || len(sc.Steps) != 0 {
+		t.Errorf("ParseScript(\"\") = %+v, %v; want empty", sc, err)
+	}
+
+	for _, bad := range []string{"loop", "ok", "ok:-1s", "up:1s", "ok:1s,loop,fail:1s", "ok:1s,"} {
+		if _, err := ParseScript(bad); err == nil {
+			t.Errorf("ParseScript(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+// TestDelayedFlag_Script verifies that a looping script drives the flag
+// through its steps, that Set stops it and that Reset restarts it.
+func TestDelayedFlag_Script(t *testing.T) {
+	f := NewDelayedFlag(time.Hour, WithScript(Script{
+		Steps: []Step{{true, 100 * time.Millisecond}, {false, 100 * time.Millisecond}},
+		Loop:  true,
+	}))
+
+	if !f.Load() {
+		t.Fatal("flag false at the start of an ok step")
+	}
+	time.Sleep(150 * time.Millisecond) // in the fail step
+	if f.Load() {
+		t.Fatal("flag still true in the fail step")
+	}
+	if f.Remaining() <= 0 {
+		t.Errorf("Remaining() in the fail step = %v, want > 0", f.Remaining())
+	}
+	time.Sleep(100 * time.Millisecond) // looped back to ok
+	if !f.Load() {
+		t.Fatal("flag did not loop back to the ok step")
+	}
+
+	f.Set(false)
+	time.Sleep(250 * time.Millisecond)
+	if f.Load() {
+		t.Fatal("script kept running after Set")
+	}
+
+	f.Reset()
+	if !f.Load() {
+		t.Fatal("Reset did not restart the script at its first step")
+	}
+}
+
+// TestDelayedFlag_ScriptNoLoop checks that without loop the flag keeps
+// the state of the last step.
+func TestDelayedFlag_ScriptNoLoop(t *testing.T) {
+	f := NewDelayedFlag(0, WithScript(Script{
+		Steps: []Step{{false, 20 * time.Millisecond}, {true, time.Millisecond}},
+	}))
+	if f.Load() {
+		t.Fatal("flag true in the first (fail) step")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !f.Load() {
+		t.Fatal("flag not true in the last step")
+	}
+	if f.Remaining() != 0 {
+		t.Errorf("Remaining() after the last step = %v, want 0", f.Remaining())
+	}
+}
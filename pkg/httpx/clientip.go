@@ -0,0 +1,102 @@
+package httpx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ctxKeyClientIP is the context key under which ClientIP stores the
+// derived client address.
+type ctxKeyClientIP struct{}
+
+// ClientIPFromContext returns the client IP stored in ctx by ClientIP,
+// or "" if none.
+func ClientIPFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(ctxKeyClientIP{}).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// ClientIP derives the real client address of every request and stores
+// it in the request context (see ClientIPFromContext).
+//
+// If the direct peer (r.RemoteAddr) lies in one of the trusted prefixes,
+// the X-Forwarded-For chain is walked from right to left, skipping
+// trusted proxies; the first untrusted address is the client. If every
+// hop is trusted, the leftmost address is used. Without trusted proxies,
+// or when the peer is not trusted, XFF is ignored and the host part of
+// RemoteAddr is the client, so clients cannot spoof their address.
+func ClientIP(trusted []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r, trusted)
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyClientIP{}, ip))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestClientIP returns the client IP derived by ClientIP, falling back
+// to the host part of r.RemoteAddr when ClientIP is not installed.
+func requestClientIP(r *http.Request) string {
+	if ip := ClientIPFromContext(r.Context()); ip != "" {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// clientIP implements the address derivation described on ClientIP.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	remote := remoteHost(r)
+	if len(trusted) == 0 || !isTrusted(remote, trusted) {
+		return remote
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(h, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if len(hops) == 0 {
+		return remote
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !isTrusted(hops[i], trusted) {
+			return hops[i]
+		}
+	}
+	return hops[0]
+}
+
+// isTrusted reports whether addr parses as an IP inside one of trusted.
+// Unparseable addresses are never trusted.
+func isTrusted(addr string, trusted []netip.Prefix) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost returns the host part of r.RemoteAddr, or RemoteAddr itself
+// if it has no port (e.g. on a unix socket).
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,202 @@
+package httpx
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressor is the subset of *gzip.Writer and *flate.Writer used by
+// compressWriter.
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// Compress compresses response bodies with gzip or deflate when the
+// client advertises support via Accept-Encoding (gzip is preferred).
+// HEAD requests, responses without a body (1xx, 204, 304, or a handler
+// that writes nothing) and responses that already carry a
+// Content-Encoding are passed through unchanged.
+//
+// The compressed stream is written to the ResponseWriter this middleware
+// receives, so an outer StatusWriter counts compressed bytes.
+func Compress() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if enc == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: enc}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// AcceptsEncoding reports whether the Accept-Encoding header of r lists
+// enc (lower case, e.g. "gzip") without excluding it by q=0.
+func AcceptsEncoding(r *http.Request, enc string) bool {
+	return acceptedEncodings(r.Header.Get("Accept-Encoding"))[enc]
+}
+
+// negotiateEncoding picks "gzip" or "deflate" from an Accept-Encoding
+// header value, honouring q=0 exclusions. It returns "" if neither is
+// acceptable.
+func negotiateEncoding(header string) string {
+	accepted := acceptedEncodings(header)
+	for _, enc := range []string{"gzip", "deflate"} {
+		if accepted[enc] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// acceptedEncodings parses an Accept-Encoding header value into a map
+// from lower-case coding name to whether its q-value is above zero.
+func acceptedEncodings(header string) map[string]bool {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[name] = q > 0
+	}
+	return accepted
+}
+
+// compressWriter compresses the body written through it. WriteHeader
+// only decides whether the response may be compressed; the status is
+// held back until the first non-empty Write (or Flush), so that a
+// response without a body never claims a Content-Encoding.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	// status is the code passed to WriteHeader, 0 before.
+	status int
+	// sent reports whether status has been forwarded.
+	sent bool
+	// c is nil until the first body write of a compressible response, and
+	// stays nil for pass-through responses.
+	c           compressor
+	passthrough bool
+}
+
+// WriteHeader decides between compression and pass-through. Pass-through
+// statuses are forwarded at once, the others once the body starts.
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.status != 0 {
+		return
+	}
+	if statusCode >= 100 && statusCode <= 199 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+	if !bodyAllowed(statusCode) || w.Header().Get("Content-Encoding") != "" {
+		w.passthrough = true
+		w.send()
+	}
+}
+
+// Write compresses b unless the response is in pass-through mode.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	w.start()
+	return w.c.Write(b)
+}
+
+// start sets the encoding headers, forwards the status and creates the
+// compressor, once.
+func (w *compressWriter) start() {
+	if w.c != nil {
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+	w.send()
+	if w.encoding == "gzip" {
+		w.c = gzip.NewWriter(w.ResponseWriter)
+	} else {
+		w.c, _ = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+	}
+}
+
+// send forwards the held back status, once.
+func (w *compressWriter) send() {
+	if !w.sent {
+		w.sent = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// Flush flushes buffered compressed data and then the underlying writer,
+// so streaming handlers keep working. A flush before any body commits the
+// response to compression, since a streamed body is expected to follow.
+func (w *compressWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.passthrough {
+		w.start()
+		_ = w.c.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// close finalises the compressed stream (writes the trailer), or forwards
+// the status of a response that had no body.
+func (w *compressWriter) close() {
+	if w.c != nil {
+		_ = w.c.Close()
+		return
+	}
+	if w.status != 0 {
+		w.send()
+	}
+}
+
+// bodyAllowed reports whether a response with the given status may carry
+// a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
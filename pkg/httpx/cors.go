@@ -0,0 +1,55 @@
+package httpx
+
+import (
+	"net/http"
+	"slices"
+)
+
+// corsAllowedMethods is advertised in preflight responses.
+const corsAllowedMethods = "GET, HEAD, POST, OPTIONS"
+
+// CORS adds Cross-Origin Resource Sharing headers for requests whose
+// Origin is in allowed. The single entry "*" allows any origin (and
+// answers with a literal "*", so credentials are not supported).
+// Requests from other origins, and requests without an Origin header,
+// pass through unchanged. An empty allowed list disables the middleware.
+//
+// Preflight requests (OPTIONS with Access-Control-Request-Method) from an
+// allowed origin are answered directly with 204, echoing the requested
+// headers; they never reach the inner handler.
+func CORS(allowed []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+		wildcard := slices.Contains(allowed, "*")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!wildcard && !slices.Contains(allowed, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			if wildcard {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Add("Vary", "Origin")
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", reqHeaders)
+					h.Add("Vary", "Access-Control-Request-Headers")
+				}
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
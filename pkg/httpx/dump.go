@@ -0,0 +1,84 @@
+package httpx
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+// redactedDumpHeaders are masked in request dumps because they carry
+// credentials.
+var redactedDumpHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// DumpRequests logs every request in wire format (httputil.DumpRequest)
+// at debug level as the "dump" field, together with the request ID. At
+// most maxBody bytes of the body are included; a non-positive maxBody
+// dumps headers only. The bytes read are put back in front of the rest
+// of the body, so handlers see it unchanged. Credentials in the
+// Authorization, Proxy-Authorization and Cookie headers are masked, and
+// so are the query parameter values, which often carry tokens.
+//
+// Dumps are verbose and may contain personal data; the middleware does
+// nothing unless log is enabled for slog.LevelDebug.
+func DumpRequests(log *slog.Logger, maxBody int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !log.Enabled(r.Context(), slog.LevelDebug) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var body []byte
+			if maxBody > 0 && r.Body != nil && r.Body != http.NoBody {
+				// One byte more than dumped tells a cut-off body apart
+				// from one of exactly maxBody bytes.
+				body, _ = io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			}
+
+			dumped := r.Clone(r.Context())
+			for _, h := range redactedDumpHeaders {
+				if dumped.Header.Get(h) != "" {
+					dumped.Header.Set(h, "[redacted]")
+				}
+			}
+			if dumped.URL.RawQuery != "" {
+				dumped.URL.RawQuery = redactQuery(dumped.URL.RawQuery)
+				dumped.RequestURI = "" // DumpRequest prefers it over URL
+			}
+			dump, err := httputil.DumpRequest(dumped, false)
+			if err != nil {
+				log.Debug("request dump failed", "err", err, "request_id", RequestIDFromContext(r.Context()))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if int64(len(body)) > maxBody {
+				dump = append(append(dump, body[:maxBody]...), "\n[truncated]"...)
+			} else {
+				dump = append(dump, body...)
+			}
+			log.Debug("request dump",
+				"request_id", RequestIDFromContext(r.Context()),
+				"dump", string(dump),
+			)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// redactQuery masks the values in the raw query q and keeps the names,
+// so "token=abc&debug" becomes "token=[redacted]&debug".
+func redactQuery(q string) string {
+	params := strings.Split(q, "&")
+	for i, p := range params {
+		if name, _, ok := strings.Cut(p, "="); ok {
+			params[i] = name + "=[redacted]"
+		}
+	}
+	return strings.Join(params, "&")
+}
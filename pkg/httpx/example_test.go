@@ -0,0 +1,28 @@
+package httpx_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"bodsch.me/probe-service/pkg/httpx"
+)
+
+// ExampleChain wraps a handler with middleware; the first middleware is
+// the outermost one.
+func ExampleChain() {
+	h := httpx.Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			httpx.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		}),
+		httpx.RequestID(""),
+		httpx.ServiceVersion("1.2.3"),
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	fmt.Println(w.Code, w.Header().Get("X-Service-Version"), w.Body.String())
+	// Output:
+	// 200 1.2.3 {"status":"ok"}
+}
@@ -0,0 +1,158 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// CamelCaseJSON rewrites the object keys of JSON responses from
+// snake_case to camelCase ("retry_after_ms" becomes "retryAfterMs"), for
+// consumers that expect that convention. Responses whose Content-Type is
+// not application/json, and requests for which exempt returns true, are
+// passed through unchanged. exempt may be nil. A handler can also exempt
+// a single response with KeepJSONKeys.
+//
+// JSON responses are buffered and re-encoded after the handler returns,
+// so Flush is a no-op for them. A body that does not parse as JSON (for
+// example an empty HEAD response) is written as it was.
+func CamelCaseJSON(exempt func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt != nil && exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &camelWriter{ResponseWriter: w}
+			defer cw.finish()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// KeepJSONKeys exempts the response written to w from CamelCaseJSON, for
+// bodies whose keys are not the handler's own (user supplied JSON, for
+// example). It must be called before the first WriteHeader or Write and
+// is a no-op when CamelCaseJSON is not in the chain.
+func KeepJSONKeys(w http.ResponseWriter) {
+	for w != nil {
+		if cw, ok := w.(*camelWriter); ok {
+			cw.keep = true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// camelWriter holds back JSON bodies until finish rewrites them.
+type camelWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	json    bool
+	keep    bool // set by KeepJSONKeys
+	buf     bytes.Buffer
+}
+
+// WriteHeader decides from the Content-Type whether the body is buffered.
+// For JSON the status is kept until finish.
+func (w *camelWriter) WriteHeader(statusCode int) {
+	if w.decided {
+		return
+	}
+	if statusCode >= 100 && statusCode <= 199 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.decided = true
+	w.status = statusCode
+	mt, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	w.json = mt == "application/json" && !w.keep
+	if !w.json {
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+// Write buffers JSON bodies and passes everything else through.
+func (w *camelWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.json {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer unless the body is buffered.
+func (w *camelWriter) Flush() {
+	if w.json {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController.
+func (w *camelWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// finish writes the held back JSON response with rewritten keys.
+func (w *camelWriter) finish() {
+	if !w.json {
+		return
+	}
+	body := w.buf.Bytes()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err == nil {
+		var out bytes.Buffer
+		if err := json.NewEncoder(&out).Encode(camelKeys(v)); err == nil {
+			body = out.Bytes()
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// camelKeys returns v with the keys of all nested objects converted by
+// camelCase.
+func camelKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[camelCase(k)] = camelKeys(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = camelKeys(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// camelCase converts a snake_case key to camelCase. Keys without an inner
+// underscore, such as "status" or "X-Request-Id", are returned unchanged.
+func camelCase(s string) string {
+	if !strings.Contains(strings.Trim(s, "_"), "_") {
+		return s
+	}
+	var b strings.Builder
+	for i, part := range strings.Split(s, "_") {
+		if i > 0 && part != "" {
+			part = strings.ToUpper(part[:1]) + part[1:]
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
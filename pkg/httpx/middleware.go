@@ -0,0 +1,403 @@
+package httpx
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware is a standard HTTP middleware constructor.
+type Middleware func(http.Handler) http.Handler
+
+// Chain composes the given middlewares around next in the order they are
+// passed: the first middleware in the slice is the outermost wrapper, which
+// makes the call order at request time identical to the slice order.
+//
+// Example: Chain(h, A, B, C) → A(B(C(h))).
+func Chain(next http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		next = mws[i](next)
+	}
+	return next
+}
+
+// ctxKeyRequestID is a private context key type used to attach the request
+// ID to a request's context without colliding with other packages.
+type ctxKeyRequestID struct{}
+
+// RequestIDFromContext returns the request ID stored in ctx, or "" if none.
+func RequestIDFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(ctxKeyRequestID{}).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// ctxKeyTraceID is the context key for the trace ID set by a tracing
+// middleware.
+type ctxKeyTraceID struct{}
+
+// WithTraceID returns a copy of ctx carrying the trace ID. Tracing
+// middleware uses it so that AccessLog can correlate log lines with
+// traces without depending on a tracing library.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyTraceID{}, id)
+}
+
+// TraceIDFromContext returns the trace ID stored in ctx, or "" if none.
+func TraceIDFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(ctxKeyTraceID{}).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// newRequestID generates a URL-safe, compact, 18-byte random identifier.
+func newRequestID() string {
+	var b [18]byte
+	_, _ = rand.Read(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// DefaultRequestIDHeader is the header used by RequestID when none is
+// configured.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// DefaultRequestIDMaxLen bounds the length of a client-supplied request
+// ID that RequestID is willing to reuse.
+const DefaultRequestIDMaxLen = 128
+
+// RequestID attaches an identifier to every request's context and echoes
+// it in the given response header (DefaultRequestIDHeader if empty).
+// An inbound value on the same header is reused when it is at most
+// DefaultRequestIDMaxLen bytes long and consists of printable ASCII only,
+// so IDs assigned by an upstream proxy or tracer survive; otherwise a
+// fresh ID is generated. Rejecting control and non-ASCII bytes keeps
+// client-chosen IDs out of log and header injection.
+func RequestID(header string) Middleware {
+	return RequestIDMaxLen(header, 0)
+}
+
+// RequestIDMaxLen is RequestID with inbound IDs limited to maxLen bytes
+// instead (DefaultRequestIDMaxLen if maxLen <= 0).
+func RequestIDMaxLen(header string, maxLen int) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	if maxLen <= 0 {
+		maxLen = DefaultRequestIDMaxLen
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !validRequestID(id, maxLen) {
+				id = newRequestID()
+			}
+			w.Header().Set(header, id)
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyRequestID{}, id))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validRequestID reports whether an inbound request ID is non-empty, at
+// most maxLen bytes and made of printable ASCII (0x20-0x7e).
+func validRequestID(id string, maxLen int) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x20 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Recoverer converts panics from downstream handlers into a JSON 500
+// response and logs the panic value together with the request method,
+// path, request ID, a correlation ID and the goroutine's stack trace
+// (field "stack"). Panics are rare enough that the stack is always
+// logged, at error level.
+//
+// The correlation ID is the request ID, or a fresh ID without one. It is
+// recorded on every StatusWriter in the writer chain, so an AccessLog
+// further out logs the same "correlation_id" together with
+// "panicked": true without the request having to be replaced.
+func Recoverer(log *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					reqID := RequestIDFromContext(r.Context())
+					id := reqID
+					if id == "" {
+						id = newRequestID()
+					}
+					markPanicked(w, id)
+					log.Error("panic recovered",
+						"panic", rec,
+						"method", r.Method,
+						"path", r.URL.Path,
+						"request_id", reqID,
+						"correlation_id", id,
+						"stack", string(debug.Stack()),
+					)
+					WriteError(w, r, http.StatusInternalServerError, "internal_error")
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// markPanicked records the correlation ID id on every StatusWriter that
+// w wraps, following Unwrap through intermediate writers.
+func markPanicked(w http.ResponseWriter, id string) {
+	for w != nil {
+		if sw, ok := w.(*StatusWriter); ok {
+			sw.correlationID = id
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// RejectMalformed answers obviously malformed requests with 400
+// "bad_request" instead of passing them on to routing: an empty method,
+// a request target that is neither origin-form ("/path"), absolute-form
+// with an http or https scheme and a host, nor "*" on OPTIONS. net/http
+// already rejects unparseable request lines and invalid Host headers
+// before any handler runs. Requests built in-process without a
+// RequestURI are not checked.
+func RejectMalformed() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if malformed(r) {
+				WriteError(w, r, http.StatusBadRequest, "bad_request")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// malformed reports whether r fails the checks of RejectMalformed.
+func malformed(r *http.Request) bool {
+	if r.Method == "" || r.URL == nil {
+		return true
+	}
+	switch uri := r.RequestURI; {
+	case uri == "":
+		return false
+	case uri == "*":
+		return r.Method != http.MethodOptions
+	case strings.HasPrefix(uri, "/"):
+		return false
+	case r.URL.IsAbs():
+		return (r.URL.Scheme != "http" && r.URL.Scheme != "https") || r.URL.Host == ""
+	default:
+		return true
+	}
+}
+
+// MaxBody caps the request body size using http.MaxBytesReader.
+// Requests whose declared Content-Length already exceeds max are answered
+// with 413 "payload_too_large" without reaching the handler; bodies of
+// unknown length fail on read, which ReadBody turns into the same 413.
+// A non-positive max disables body limiting.
+func MaxBody(max int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if max > 0 {
+				if r.ContentLength > max {
+					WriteError(w, r, http.StatusRequestEntityTooLarge, "payload_too_large")
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, max)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ServiceVersion sets the X-Service-Version response header on every reply,
+// for both success and error responses (because the header is set before
+// the inner handler writes the status code).
+func ServiceVersion(version string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Service-Version", version)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SecurityHeaders sets X-Content-Type-Options: nosniff and
+// X-Frame-Options: DENY on every response. On TLS connections, a positive
+// hstsMaxAge additionally sets Strict-Transport-Security with that
+// max-age (whole seconds). Headers are set before the inner handler runs,
+// so handlers may still set their own Content-Type.
+func SecurityHeaders(hstsMaxAge time.Duration) Middleware {
+	hsts := ""
+	if secs := int64(hstsMaxAge / time.Second); secs > 0 {
+		hsts = "max-age=" + strconv.FormatInt(secs, 10)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			if hsts != "" && r.TLS != nil {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// StaticHeaders adds the headers in h to every response. They are set
+// before the inner handler runs, so handlers may still override them. A
+// nil or empty h returns next unchanged.
+func StaticHeaders(h http.Header) Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(h) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dst := w.Header()
+			for k, vs := range h {
+				dst[k] = append(dst[k][:0:0], vs...)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AccessLog logs request/response metadata (method, path, status, bytes,
+// latency, request ID, user agent, remote addr, the client IP derived by
+// ClientIP and, if present, the trace ID) in structured form. If a
+// Recoverer further in recovered a panic, the line also has
+// "panicked": true and the "correlation_id" of the panic log.
+func AccessLog(log *slog.Logger) Middleware {
+	return SampledAccessLog(log, 1, nil, nil)
+}
+
+// SampledAccessLog is AccessLog with sampling: successful (2xx) requests
+// for which sampled returns true are logged with probability rate. All
+// other requests, and every non-2xx response, are always logged. A nil
+// sampled applies the rate to all requests. rnd returns a value in
+// [0, 1) and may be injected for deterministic tests; nil uses
+// math/rand/v2.
+func SampledAccessLog(log *slog.Logger, rate float64, sampled func(*http.Request) bool, rnd func() float64) Middleware {
+	if rnd == nil {
+		rnd = mathrand.Float64
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := NewStatusWriter(w)
+
+			next.ServeHTTP(sw, r)
+
+			if rate < 1 && sw.Status()/100 == 2 && (sampled == nil || sampled(r)) && rnd() >= rate {
+				return
+			}
+			attrs := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", sw.Status(),
+				"bytes", sw.Bytes(),
+				"duration_ms", time.Since(start).Milliseconds(),
+				"request_id", RequestIDFromContext(r.Context()),
+				"user_agent", r.UserAgent(),
+				"remote", r.RemoteAddr,
+				"client_ip", requestClientIP(r),
+			}
+			if traceID := TraceIDFromContext(r.Context()); traceID != "" {
+				attrs = append(attrs, "trace_id", traceID)
+			}
+			if sw.correlationID != "" {
+				attrs = append(attrs, "panicked", true, "correlation_id", sw.correlationID)
+			}
+			log.Info("probe", attrs...)
+		})
+	}
+}
+
+// BearerAuth rejects requests whose Authorization header does not carry
+// "Bearer <token>" with a JSON 401 "unauthorized". The comparison is
+// constant-time to avoid leaking the token through response timing.
+// An empty token disables the check.
+func BearerAuth(token string) Middleware {
+	want := []byte(token)
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				WriteError(w, r, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Latency delays every response by def before calling the inner handler.
+// Clients may override the delay per request with a "delay" query
+// parameter in Go duration format (e.g. ?delay=250ms); the override is
+// capped at max, and a non-positive max disables it. An unparseable or
+// negative override yields a JSON 400 "invalid_delay".
+//
+// The sleep observes the request context: if the client disconnects
+// while waiting, the inner handler is not invoked and nothing is written.
+func Latency(def, max time.Duration) Middleware {
+	return ScopedLatency(def, max, nil)
+}
+
+// ScopedLatency is Latency with the ?delay= override limited to requests
+// for which override returns true. Other requests still get def, and
+// their "delay" parameter is ignored rather than validated. A nil
+// override allows it on all requests.
+func ScopedLatency(def, max time.Duration, override func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := def
+			if max > 0 && (override == nil || override(r)) {
+				if q := r.URL.Query().Get("delay"); q != "" {
+					v, err := time.ParseDuration(q)
+					if err != nil || v < 0 {
+						WriteError(w, r, http.StatusBadRequest, "invalid_delay")
+						return
+					}
+					d = min(v, max)
+				}
+			}
+			if d > 0 {
+				t := time.NewTimer(d)
+				defer t.Stop()
+				select {
+				case <-r.Context().Done():
+					return
+				case <-t.C:
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
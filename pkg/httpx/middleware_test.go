@@ -0,0 +1,480 @@
+package httpx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSampledAccessLog checks that successful sampled requests are logged
+// according to the injected random source while errors and unsampled
+// paths are always logged.
+func TestSampledAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+
+	rolls := []float64{0.1, 0.9}
+	rnd := func() float64 {
+		v := rolls[0]
+		rolls = append(rolls[1:], v)
+		return v
+	}
+	isProbe := func(r *http.Request) bool { return r.URL.Path == "/healthz" }
+	status := http.StatusOK
+	h := SampledAccessLog(log, 0.5, isProbe, rnd)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	cases := []struct {
+		path   string
+		status int
+		logged bool
+	}{
+		{"/healthz", http.StatusOK, true},                 // roll 0.1 < 0.5
+		{"/healthz", http.StatusOK, false},                // roll 0.9 >= 0.5
+		{"/healthz", http.StatusServiceUnavailable, true}, // errors always
+		{"/version", http.StatusOK, true},                 // not sampled
+	}
+	for i, tc := range cases {
+		buf.Reset()
+		status = tc.status
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if got := strings.Contains(buf.String(), "path="+tc.path); got != tc.logged {
+			t.Errorf("case %d (%s %d): logged = %v, want %v", i, tc.path, tc.status, got, tc.logged)
+		}
+	}
+}
+
+// TestStaticHeaders checks that configured headers are added to every
+// response and that handlers can still override them.
+func TestStaticHeaders(t *testing.T) {
+	h := StaticHeaders(http.Header{
+		"X-Cache":  {"HIT"},
+		"X-Served": {"edge-1", "edge-2"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/override" {
+			w.Header().Set("X-Cache", "MISS")
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("X-Cache"); got != "HIT" {
+		t.Errorf("X-Cache = %q, want HIT", got)
+	}
+	if got := rec.Header().Values("X-Served"); len(got) != 2 {
+		t.Errorf("X-Served = %v, want two values", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/override", nil))
+	if got := rec.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("X-Cache = %q, want handler override MISS", got)
+	}
+}
+
+// TestTimeout checks that a slow handler, also one that gives up when its
+// context is cancelled, is answered with 504, that the status is visible
+// to an outer StatusWriter, and that fast and exempt requests pass
+// through unchanged.
+func TestTimeout(t *testing.T) {
+	h := Timeout(20*time.Millisecond, func(r *http.Request) bool { return r.URL.Path == "/exempt" })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/cancelled" {
+				<-r.Context().Done() // returns at the deadline without writing
+				return
+			}
+			if r.URL.Path != "/fast" {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+			w.Header().Set("X-Handler", "done")
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+	cases := []struct {
+		path   string
+		status int
+	}{
+		{"/slow", http.StatusGatewayTimeout},
+		{"/cancelled", http.StatusGatewayTimeout},
+		{"/fast", http.StatusCreated},
+		{"/exempt", http.StatusCreated},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		sw := NewStatusWriter(rec)
+		h.ServeHTTP(sw, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if sw.Status() != tc.status || rec.Code != tc.status {
+			t.Errorf("%s: recorded %d, sent %d, want %d", tc.path, sw.Status(), rec.Code, tc.status)
+		}
+		if tc.status == http.StatusGatewayTimeout {
+			if !strings.Contains(rec.Body.String(), "gateway_timeout") {
+				t.Errorf("%s: body = %q, want gateway_timeout", tc.path, rec.Body.String())
+			}
+		} else if rec.Header().Get("X-Handler") != "done" {
+			t.Errorf("%s: handler header not copied", tc.path)
+		}
+	}
+}
+
+// TestRequestID checks which inbound request IDs are reused and which are
+// replaced by a generated one.
+func TestRequestID(t *testing.T) {
+	cases := []struct {
+		name  string
+		id    string
+		reuse bool
+	}{
+		{"plain", "abc-123", true},
+		{"at limit", strings.Repeat("a", 16), true},
+		{"oversized", strings.Repeat("a", 17), false},
+		{"empty", "", false},
+		{"control", "abc\x00def", false},
+		{"tab", "abc\tdef", false},
+		{"escape", "abc\x1b[31m", false},
+		{"non-ascii", "abc\u00e9", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			h := RequestIDMaxLen("", 16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestIDFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header[DefaultRequestIDHeader] = []string{tc.id}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if echoed := rec.Header().Get(DefaultRequestIDHeader); echoed != got {
+				t.Errorf("header = %q, context = %q", echoed, got)
+			}
+			if reused := got == tc.id; reused != tc.reuse {
+				t.Errorf("request ID = %q for inbound %q, reuse = %v", got, tc.id, tc.reuse)
+			}
+			if !tc.reuse && len(got) != 24 {
+				t.Errorf("generated request ID %q, want 24 characters", got)
+			}
+		})
+	}
+}
+
+// TestDumpRequests checks that requests are dumped with a truncated body
+// and masked credentials and query values, that handlers still read the
+// whole body, and that nothing is dumped unless debug logging is enabled.
+func TestDumpRequests(t *testing.T) {
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo} {
+		var buf bytes.Buffer
+		log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level}))
+		var got string
+		h := DumpRequests(log, 5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			got = string(b)
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/echo?token=s3cret&debug", strings.NewReader("hello world"))
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Forwarded-For", "192.0.2.1")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got != "hello world" {
+			t.Errorf("level %v: handler read %q, want the full body", level, got)
+		}
+
+		if level != slog.LevelDebug {
+			if buf.Len() != 0 {
+				t.Errorf("level %v: dumped %s", level, buf.String())
+			}
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("decode log %q: %v", buf.String(), err)
+		}
+		dump, _ := entry["dump"].(string)
+		for _, want := range []string{"POST /echo?token=[redacted]&debug HTTP/1.1", "X-Forwarded-For: 192.0.2.1", "Authorization: [redacted]", "\r\n\r\nhello\n[truncated]"} {
+			if !strings.Contains(dump, want) {
+				t.Errorf("dump %q does not contain %q", dump, want)
+			}
+		}
+		if strings.Contains(dump, "secret") || strings.Contains(dump, "s3cret") {
+			t.Errorf("dump %q leaks the credentials", dump)
+		}
+	}
+}
+
+// TestCompress checks that bodies are gzipped and that responses without
+// a body keep their status but get no Content-Encoding.
+func TestCompress(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		gzipped bool
+	}{
+		{"body", func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "hello") }, http.StatusOK, true},
+		{"status only", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) }, http.StatusAccepted, false},
+		{"empty write", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(nil) }, http.StatusOK, false},
+		{"nothing", func(http.ResponseWriter, *http.Request) {}, http.StatusOK, false},
+		{"no content", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }, http.StatusNoContent, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			Compress()(tc.handler).ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Errorf("status = %d, want %d", rec.Code, tc.status)
+			}
+			enc := rec.Header().Get("Content-Encoding")
+			if !tc.gzipped {
+				if enc != "" || rec.Body.Len() != 0 {
+					t.Errorf("Content-Encoding = %q, body %q; want neither", enc, rec.Body.String())
+				}
+				return
+			}
+			zr, err := gzip.NewReader(rec.Body)
+			if enc != "gzip" || err != nil {
+				t.Fatalf("Content-Encoding = %q, gzip.NewReader: %v", enc, err)
+			}
+			if b, _ := io.ReadAll(zr); string(b) != "hello" {
+				t.Errorf("body = %q, want hello", b)
+			}
+		})
+	}
+}
+
+// TestCamelCaseJSON checks that keys of nested JSON objects are rewritten,
+// values and non-JSON responses are left alone and the status is kept.
+func TestCamelCaseJSON(t *testing.T) {
+	h := CamelCaseJSON(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/text" {
+			WriteText(w, http.StatusOK, `{"snake_key":1}`)
+			return
+		}
+		WriteJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"retry_after_ms": 1500,
+			"status":         "not_ready",
+			"checks":         []any{map[string]any{"latency_ms": 3}},
+			"X-Request-Id":   "abc",
+		})
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	want := `{"X-Request-Id":"abc","checks":[{"latencyMs":3}],"retryAfterMs":1500,"status":"not_ready"}` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("body = %s, want %s", rec.Body.String(), want)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/text", nil))
+	if rec.Body.String() != `{"snake_key":1}` {
+		t.Errorf("text body = %s, want it unchanged", rec.Body.String())
+	}
+
+	h = CamelCaseJSON(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		KeepJSONKeys(DiscardBody(w))
+		WriteJSON(w, http.StatusOK, map[string]any{"snake_key": 1})
+	}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Body.String() != `{"snake_key":1}`+"\n" {
+		t.Errorf("KeepJSONKeys body = %s, want it unchanged", rec.Body.String())
+	}
+}
+
+// TestRecoverer checks that a panic becomes a 500 and is logged with the
+// request method, path and the stack of the panicking handler.
+func TestRecoverer(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := Recoverer(log)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/explode", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode log %q: %v", buf.String(), err)
+	}
+	if entry["panic"] != "boom" || entry["method"] != "POST" || entry["path"] != "/explode" {
+		t.Errorf("log entry = %v", entry)
+	}
+	if stack, _ := entry["stack"].(string); !strings.Contains(stack, "TestRecoverer") {
+		t.Errorf("stack = %q, want the panicking handler", stack)
+	}
+}
+
+// TestRecoverer_AccessLog checks that the panic log and the access log
+// share the request ID as correlation ID and that only the access log of
+// a panicking request is marked as panicked.
+func TestRecoverer_AccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/explode" {
+			panic("boom")
+		}
+	}), RequestID(""), AccessLog(log), Recoverer(log))
+
+	req := httptest.NewRequest(http.MethodGet, "/explode", nil)
+	req.Header.Set(DefaultRequestIDHeader, "abc123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	dec := json.NewDecoder(&buf)
+	var panicEntry, accessEntry map[string]any
+	if err := dec.Decode(&panicEntry); err != nil {
+		t.Fatalf("decode panic log: %v", err)
+	}
+	if err := dec.Decode(&accessEntry); err != nil {
+		t.Fatalf("decode access log: %v", err)
+	}
+	if panicEntry["correlation_id"] != "abc123" || accessEntry["correlation_id"] != "abc123" {
+		t.Errorf("correlation_id = %v (panic) / %v (access), want the request ID abc123",
+			panicEntry["correlation_id"], accessEntry["correlation_id"])
+	}
+	if accessEntry["panicked"] != true || accessEntry["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("access log = %v, want panicked=true and status 500", accessEntry)
+	}
+
+	buf.Reset()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/calm", nil))
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode access log %q: %v", buf.String(), err)
+	}
+	if _, ok := entry["panicked"]; ok {
+		t.Errorf("access log = %v, want no panicked field without a panic", entry)
+	}
+}
+
+// TestWriteError_RequestID checks that error responses carry the request
+// ID assigned by the RequestID middleware, and omit it without one.
+func TestWriteError_RequestID(t *testing.T) {
+	fail := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusInternalServerError, "internal_error")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultRequestIDHeader, "abc123")
+	rec := httptest.NewRecorder()
+	RequestID("")(fail).ServeHTTP(rec, req)
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["error"] != "internal_error" || body["request_id"] != "abc123" {
+		t.Errorf("body = %v, want error internal_error and request_id abc123", body)
+	}
+
+	rec = httptest.NewRecorder()
+	fail.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Contains(rec.Body.String(), "request_id") {
+		t.Errorf("body without request ID = %s", rec.Body.String())
+	}
+}
+
+// TestRejectMalformed checks which request targets are rejected with 400
+// and that the access log records the status.
+func TestRejectMalformed(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cases := []struct {
+		name   string
+		method string
+		target string
+		uri    string // overrides RequestURI when set
+		want   int
+	}{
+		{"origin form", http.MethodGet, "/healthz", "", http.StatusOK},
+		{"absolute form", http.MethodGet, "http://example.com/healthz", "", http.StatusOK},
+		{"options asterisk", http.MethodOptions, "*", "", http.StatusOK},
+		{"get asterisk", http.MethodGet, "*", "", http.StatusBadRequest},
+		{"foreign scheme", http.MethodGet, "ftp://example.com/healthz", "", http.StatusBadRequest},
+		{"relative path", http.MethodGet, "/", "healthz", http.StatusBadRequest},
+		{"empty method", "", "/healthz", "", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := slog.New(slog.NewTextHandler(&buf, nil))
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			req.Method = tc.method
+			if tc.uri != "" {
+				req.RequestURI = tc.uri
+			}
+			rec := httptest.NewRecorder()
+			Chain(ok, AccessLog(log), RejectMalformed()).ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+			if !strings.Contains(buf.String(), "status="+strconv.Itoa(tc.want)) {
+				t.Errorf("access log = %q, want status=%d", buf.String(), tc.want)
+			}
+			if tc.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), `"bad_request"`) {
+				t.Errorf("body = %s, want bad_request", rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestFormatTime covers the three TIME_FORMAT renderings and that
+// WithTimeFormat applies one to the request.
+func TestFormatTime(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 500_000_000, time.FixedZone("CEST", 2*60*60))
+	for _, tc := range []struct {
+		format TimeFormat
+		want   any
+	}{
+		{TimeRFC3339, "2024-05-01T10:00:00Z"},
+		{TimeRFC3339Nano, "2024-05-01T10:00:00.5Z"},
+		{TimeUnixMillis, int64(1714557600500)},
+	} {
+		var got any
+		h := WithTimeFormat(tc.format)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FormatTime(r, ts)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if got != tc.want {
+			t.Errorf("format %d: FormatTime = %#v, want %#v", tc.format, got, tc.want)
+		}
+	}
+	if got := FormatTime(httptest.NewRequest(http.MethodGet, "/", nil), ts); got != "2024-05-01T10:00:00Z" {
+		t.Errorf("without WithTimeFormat: FormatTime = %#v, want RFC3339", got)
+	}
+}
+
+// TestBucketLRU checks that the per-client buckets never exceed their cap
+// and that the least recently seen client is evicted first.
+func TestBucketLRU(t *testing.T) {
+	now := time.Now()
+	l := newBucketLRU(2)
+	l.get("a", now, 1).take(now, 1, 1)
+	l.get("b", now, 1)
+	l.get("a", now, 1) // a is now more recent than b
+	l.get("c", now, 1) // evicts b
+	if l.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", l.Len())
+	}
+	if _, ok := l.byKey["b"]; ok {
+		t.Error("b still present, want it evicted as least recently used")
+	}
+	if ok, _ := l.get("a", now, 1).take(now, 1, 1); ok {
+		t.Error("a was recreated, want its drained bucket kept")
+	}
+}
@@ -0,0 +1,122 @@
+package httpx
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimitKeys bounds the number of per-client buckets kept by
+// RateLimit. When it is reached, the bucket of the least recently seen
+// client is dropped before a new one is added.
+const maxRateLimitKeys = 10000
+
+// bucket is a token bucket. tokens is refilled lazily on every take.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills b for the time elapsed since the last call and tries to
+// consume one token. If none is available it returns false and how long
+// the caller has to wait until one is.
+func (b *bucket) take(now time.Time, rps float64, burst int) (bool, time.Duration) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rps)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rps * float64(time.Second))
+}
+
+// bucketLRU holds at most max per-client buckets, ordered by last use.
+// It is not safe for concurrent use.
+type bucketLRU struct {
+	max   int
+	order *list.List // of *keyedBucket, most recently used first
+	byKey map[string]*list.Element
+}
+
+// keyedBucket is a bucketLRU entry.
+type keyedBucket struct {
+	key string
+	bucket
+}
+
+func newBucketLRU(max int) *bucketLRU {
+	return &bucketLRU{max: max, order: list.New(), byKey: make(map[string]*list.Element)}
+}
+
+// get returns the bucket for key and marks it as most recently used. A
+// missing bucket is created full, after evicting the least recently used
+// one if the LRU is at capacity.
+func (l *bucketLRU) get(key string, now time.Time, burst int) *bucket {
+	if e, ok := l.byKey[key]; ok {
+		l.order.MoveToFront(e)
+		return &e.Value.(*keyedBucket).bucket
+	}
+	if l.order.Len() >= l.max {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.byKey, oldest.Value.(*keyedBucket).key)
+	}
+	kb := &keyedBucket{key: key, bucket: bucket{tokens: float64(burst), last: now}}
+	l.byKey[key] = l.order.PushFront(kb)
+	return &kb.bucket
+}
+
+// Len returns the number of buckets held.
+func (l *bucketLRU) Len() int { return l.order.Len() }
+
+// RateLimit limits requests to rps per second with bursts of up to burst
+// requests, using a token bucket. With perClient the limit applies per
+// client IP (see ClientIP); otherwise one bucket is shared by all
+// clients. Rejected requests get 429 "rate_limited" and a Retry-After
+// header in whole seconds.
+//
+// Requests for which exempt returns true bypass the limiter entirely.
+// exempt runs before routing, so it should match on r.URL.Path. A
+// non-positive rps disables the middleware; a burst below 1 is treated
+// as 1.
+func RateLimit(rps float64, burst int, perClient bool, exempt func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		if rps <= 0 {
+			return next
+		}
+		burst := max(burst, 1)
+
+		var (
+			mu      sync.Mutex
+			global  = &bucket{tokens: float64(burst), last: time.Now()}
+			buckets = newBucketLRU(maxRateLimitKeys)
+		)
+		allow := func(key string) (bool, time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			now := time.Now()
+			if !perClient {
+				return global.take(now, rps, burst)
+			}
+			return buckets.get(key, now, burst).take(now, rps, burst)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt != nil && exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ok, wait := allow(requestClientIP(r))
+			if !ok {
+				secs := max(int(math.Ceil(wait.Seconds())), 1)
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				WriteError(w, r, http.StatusTooManyRequests, "rate_limited")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package httpx provides reusable HTTP plumbing: JSON and plain-text
+// response helpers, middleware (request-id, panic recovery, malformed
+// request rejection, body limits, access logging, bearer-token auth,
+// latency injection, timeouts, compression, CORS, rate limiting, security
+// and static headers) and a status-capturing ResponseWriter.
+//
+// The package depends only on the standard library and can be imported
+// by other services:
+//
+//	h := httpx.Chain(mux,
+//		httpx.RequestID(""),
+//		httpx.AccessLog(logger),
+//		httpx.Recoverer(logger),
+//	)
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteJSON serialises payload as JSON and writes it with the given status.
+// The "Content-Type" header is always set. Encoding errors are intentionally
+// ignored because no useful recovery is possible after WriteHeader.
+func WriteJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// WriteText writes body as text/plain with the given status.
+func WriteText(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, body)
+}
+
+// WriteError writes a small, consistent JSON error response with the
+// provided machine-readable code. The request ID assigned by the RequestID
+// middleware is included as "request_id" (when present) so that clients
+// can quote it and the failure can be found in the server logs.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	body := map[string]any{
+		"error": code,
+		"time":  Timestamp(r),
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		body["request_id"] = id
+	}
+	WriteJSON(w, status, body)
+}
+
+// DiscardBody wraps w so that the status and headers are sent but body
+// writes are dropped (and reported as successful). Handlers use it to
+// answer HEAD with exactly the status and headers of the matching GET;
+// byte counts recorded further out, e.g. by StatusWriter, stay at zero.
+func DiscardBody(w http.ResponseWriter) http.ResponseWriter { return discardBody{w} }
+
+type discardBody struct{ http.ResponseWriter }
+
+func (d discardBody) Write(b []byte) (int, error) { return len(b), nil }
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController.
+func (d discardBody) Unwrap() http.ResponseWriter { return d.ResponseWriter }
+
+// RequireMethod reports whether r uses one of methods. Otherwise it sets
+// the Allow header to the permitted methods, writes 405
+// "method_not_allowed" and returns false; handlers should simply return
+// in that case.
+func RequireMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	if slices.Contains(methods, r.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	WriteError(w, r, http.StatusMethodNotAllowed, "method_not_allowed")
+	return false
+}
+
+// RequireJSON reports whether r either has no body or declares it as
+// "Content-Type: application/json" (parameters such as charset are
+// allowed). Otherwise it writes 415 "unsupported_media_type" and returns
+// false, which keeps HTML forms and other simple cross-site requests from
+// triggering state changes. A body of unknown length counts as present.
+func RequireJSON(w http.ResponseWriter, r *http.Request) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mt == "application/json" {
+		return true
+	}
+	WriteError(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type")
+	return false
+}
+
+// Negotiate picks the media type from offers that r's Accept header
+// prefers. Each offer gets the q value of the most specific matching
+// range ("text/plain" over "text/*" over "*/*"); ties, a missing Accept
+// header and a header that accepts none of the offers all resolve to the
+// earliest offer, so offers[0] is the default. It panics if offers is
+// empty.
+func Negotiate(r *http.Request, offers ...string) string {
+	header := r.Header.Get("Accept")
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		typ, _, _ := strings.Cut(offer, "/")
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			var s int
+			switch name {
+			case offer:
+				s = 2
+			case typ + "/*":
+				s = 1
+			case "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1.0
+			for _, param := range strings.Split(params, ";") {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						q = f
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// ReadBody reads the whole request body. If reading fails it writes the
+// error response itself and returns ok=false: 413 "payload_too_large"
+// when the MaxBody limit was hit (*http.MaxBytesError), 400
+// "invalid_body" otherwise. Handlers should simply return in that case.
+func ReadBody(w http.ResponseWriter, r *http.Request) (data []byte, ok bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, r, http.StatusRequestEntityTooLarge, "payload_too_large")
+		} else {
+			WriteError(w, r, http.StatusBadRequest, "invalid_body")
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// NowRFC3339 returns the current UTC time formatted as RFC3339 (no fractional
+// seconds).
+//
+// Deprecated: use Timestamp, which honours WithTimeFormat.
+func NowRFC3339() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// TimeFormat selects how timestamps in responses are rendered.
+type TimeFormat int32
+
+const (
+	// TimeRFC3339 renders "2006-01-02T15:04:05Z" strings (the default).
+	TimeRFC3339 TimeFormat = iota
+	// TimeRFC3339Nano adds up to nine fractional digits.
+	TimeRFC3339Nano
+	// TimeUnixMillis renders milliseconds since the Unix epoch as a
+	// JSON number.
+	TimeUnixMillis
+)
+
+// Format renders t in UTC in format f: a string for the RFC3339 formats,
+// an int64 for TimeUnixMillis.
+func (f TimeFormat) Format(t time.Time) any {
+	switch f {
+	case TimeRFC3339Nano:
+		return t.UTC().Format(time.RFC3339Nano)
+	case TimeUnixMillis:
+		return t.UnixMilli()
+	default:
+		return t.UTC().Format(time.RFC3339)
+	}
+}
+
+// ctxKeyTimeFormat is the context key for the TimeFormat set by
+// WithTimeFormat.
+type ctxKeyTimeFormat struct{}
+
+// WithTimeFormat stores f in every request's context, so that Timestamp,
+// FormatTime and WriteError render times in f for the handlers and
+// middlewares below it. Without it they use TimeRFC3339. Like RequestID
+// it replaces the request, so it belongs near the top of the chain.
+func WithTimeFormat(f TimeFormat) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyTimeFormat{}, f)))
+		})
+	}
+}
+
+// TimeFormatFromContext returns the TimeFormat stored in ctx by
+// WithTimeFormat, or TimeRFC3339 if none.
+func TimeFormatFromContext(ctx context.Context) TimeFormat {
+	f, _ := ctx.Value(ctxKeyTimeFormat{}).(TimeFormat)
+	return f
+}
+
+// FormatTime renders t in the time format of r (see WithTimeFormat).
+// Centralised so the format stays consistent across responses.
+func FormatTime(r *http.Request, t time.Time) any {
+	return TimeFormatFromContext(r.Context()).Format(t)
+}
+
+// Timestamp returns FormatTime(r, time.Now()), the "time" field of JSON
+// responses.
+func Timestamp(r *http.Request) any { return FormatTime(r, time.Now()) }
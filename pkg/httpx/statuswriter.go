@@ -9,6 +9,8 @@ type StatusWriter struct {
 	status      int
 	bytes       int64
 	wroteHeader bool
+	// correlationID is set by Recoverer when the handler panicked.
+	correlationID string
 }
 
 // NewStatusWriter wraps w with a StatusWriter pre-initialised to 200.
@@ -43,3 +45,14 @@ func (w *StatusWriter) Write(b []byte) (int, error) {
 	w.bytes += int64(n)
 	return n, err
 }
+
+// Flush forwards to the underlying writer if it implements http.Flusher,
+// so that wrapping a writer does not break streaming responses.
+func (w *StatusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController.
+func (w *StatusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,144 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout answers 504 "gateway_timeout" when the inner handler has not
+// finished within d. Unlike http.TimeoutHandler it replies with the
+// package's JSON error envelope and the gateway status, so that a slow
+// handler can be told apart from an overloaded one.
+//
+// The handler runs in its own goroutine with a context that is cancelled
+// at the deadline. Its headers and body are buffered and copied to w only
+// if it finishes in time; later writes fail with http.ErrHandlerTimeout.
+// Streaming (http.Flusher) is therefore not available below Timeout.
+// Panics in the handler are re-raised on the serving goroutine so that an
+// outer Recoverer still sees them.
+//
+// The inner handler receives a copy of the request carrying the new
+// context. r.Pattern, as set by an inner ServeMux, is copied back to the
+// original request when the handler finishes in time; timed-out requests
+// keep an empty pattern.
+//
+// Requests for which exempt returns true bypass the timeout. A
+// non-positive d disables the middleware.
+func Timeout(d time.Duration, exempt func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt != nil && exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			inner := r.WithContext(ctx)
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			// inTime is written before done is closed and read after.
+			var inTime bool
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, inner)
+				inTime = ctx.Err() == nil
+				close(done)
+			}()
+
+			finish := func() {
+				r.Pattern = inner.Pattern
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, vs := range tw.header {
+					dst[k] = vs
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.buf.Bytes())
+			}
+
+			finished := false
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				finished = true
+			case <-ctx.Done():
+				// select picks at random among ready cases, so a handler
+				// that finished right at the deadline is checked for
+				// first rather than replaced by a 504.
+				select {
+				case p := <-panicked:
+					panic(p)
+				case <-done:
+					finished = true
+				default:
+				}
+			}
+			// A handler that only returned because its context was
+			// cancelled (Latency, for one) still times out.
+			if finished && inTime {
+				finish()
+				return
+			}
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				WriteError(w, r, http.StatusGatewayTimeout, "gateway_timeout")
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a response for Timeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+// Header returns the buffered header map. Handlers must not use it after
+// they return, as with any http.ResponseWriter.
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+// WriteHeader records the first status code.
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status == 0 && !tw.timedOut {
+		tw.status = code
+	}
+}
+
+// Write buffers b, or fails with http.ErrHandlerTimeout after the
+// deadline.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
@@ -0,0 +1,204 @@
+// Package proxyproto implements the receiving side of the HAProxy PROXY
+// protocol (versions 1 and 2), as sent by load balancers such as AWS NLB
+// to pass on the original client address of a TCP connection.
+//
+// The package depends only on the standard library and can be imported
+// by other services:
+//
+//	ln, _ := net.Listen("tcp", ":8080")
+//	srv.Serve(proxyproto.NewListener(ln, 5*time.Second))
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxV1Len is the maximum length of a version 1 header including CRLF.
+const maxV1Len = 107
+
+// ErrNoHeader is returned by reads on a connection that did not start
+// with a PROXY protocol header.
+var ErrNoHeader = errors.New("proxyproto: missing PROXY protocol header")
+
+// NewListener wraps ln so that every accepted connection must start with
+// a PROXY protocol header. The header is consumed and RemoteAddr reports
+// the client address it carries; for LOCAL (v2) and UNKNOWN (v1) headers
+// the address of the peer is kept.
+//
+// The header is read lazily, on the first Read or RemoteAddr call, so
+// Accept never blocks on a slow client. timeout bounds the wait for the
+// header; a non-positive timeout waits indefinitely. Connections without
+// a valid header fail every Read with an error (ErrNoHeader if the
+// header is missing), which makes an http.Server close them.
+func NewListener(ln net.Listener, timeout time.Duration) net.Listener {
+	return &listener{Listener: ln, timeout: timeout}
+}
+
+type listener struct {
+	net.Listener
+	timeout time.Duration
+}
+
+// Accept wraps the next connection; see NewListener.
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, timeout: l.timeout}, nil
+}
+
+// conn is a connection whose PROXY header is parsed on first use.
+type conn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	br     *bufio.Reader
+	remote net.Addr // nil: keep Conn.RemoteAddr()
+	err    error
+}
+
+// init reads the header exactly once.
+func (c *conn) init() {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.br = bufio.NewReader(c.Conn)
+		c.remote, c.err = readHeader(c.br)
+	})
+}
+
+// Read reads data following the header.
+func (c *conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, falling back
+// to the address of the peer.
+func (c *conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// NetConn returns the underlying connection, like tls.Conn.NetConn. Its
+// RemoteAddr is the address of the proxy, available without waiting for
+// the header.
+func (c *conn) NetConn() net.Conn { return c.Conn }
+
+// readHeader consumes a version 1 or 2 header from br and returns the
+// source address it carries, or nil if it carries none.
+func readHeader(br *bufio.Reader) (net.Addr, error) {
+	start, err := br.Peek(5)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: read header: %w", err)
+	}
+	switch {
+	case bytes.Equal(start, v2Signature[:5]):
+		return readV2(br)
+	case string(start) == "PROXY":
+		return readV1(br)
+	default:
+		return nil, ErrNoHeader
+	}
+}
+
+// readV1 parses a text header such as
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readV1(br *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("proxyproto: read v1 header: %w", err)
+		}
+		if line = append(line, b); len(line) > maxV1Len {
+			return nil, errors.New("proxyproto: v1 header too long")
+		}
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[0] == "PROXY" && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || fields[0] != "PROXY" || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxyproto: invalid v1 header %q", line)
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil || ip.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("proxyproto: invalid v1 source address %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid v1 source port %q", fields[4])
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// readV2 parses a binary header: the signature, version/command, family,
+// a big-endian payload length and the payload with the addresses.
+func readV2(br *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, fmt.Errorf("proxyproto: read v2 header: %w", err)
+	}
+	if !bytes.Equal(hdr[:12], v2Signature) {
+		return nil, ErrNoHeader
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("proxyproto: unsupported v2 version %d", hdr[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, fmt.Errorf("proxyproto: read v2 addresses: %w", err)
+	}
+
+	switch cmd := hdr[12] & 0x0f; cmd {
+	case 0x0: // LOCAL: health checks from the proxy itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported v2 command %d", cmd)
+	}
+
+	var ip []byte
+	var port []byte
+	switch family := hdr[13] >> 4; family {
+	case 0x1: // AF_INET: src, dst (4 bytes each), src port, dst port
+		if len(payload) < 12 {
+			return nil, errors.New("proxyproto: short v2 IPv4 addresses")
+		}
+		ip, port = payload[0:4], payload[8:10]
+	case 0x2: // AF_INET6: src, dst (16 bytes each), src port, dst port
+		if len(payload) < 36 {
+			return nil, errors.New("proxyproto: short v2 IPv6 addresses")
+		}
+		ip, port = payload[0:16], payload[32:34]
+	default: // AF_UNSPEC, AF_UNIX: no usable client address
+		return nil, nil
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr.Unmap(), binary.BigEndian.Uint16(port))), nil
+}
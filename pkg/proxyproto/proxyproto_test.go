@@ -0,0 +1,114 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// v2Header builds a version 2 PROXY header for cmd and family with the
+// given address payload.
+func v2Header(cmd, family byte, payload []byte) []byte {
+	h := append([]byte{}, v2Signature...)
+	h = append(h, 0x20|cmd, family<<4|0x1)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(payload)))
+	return append(h, payload...)
+}
+
+// serve accepts one connection from a proxyproto listener, sends data
+// over it from the client side and returns the server-side RemoteAddr,
+// the data read after the header and the read error.
+func serve(t *testing.T, data []byte) (remote string, body string, err error) {
+	t.Helper()
+	inner, lerr := net.Listen("tcp", "127.0.0.1:0")
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	ln := NewListener(inner, time.Second)
+	defer ln.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = c.Write(data)
+	}()
+
+	c, aerr := ln.Accept()
+	if aerr != nil {
+		t.Fatal(aerr)
+	}
+	defer c.Close()
+	remote = c.RemoteAddr().String()
+	b, err := io.ReadAll(c)
+	return remote, string(b), err
+}
+
+// TestListener covers the supported header variants: the client address
+// replaces the peer address and the header is stripped from the stream.
+func TestListener(t *testing.T) {
+	v4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	v6 := make([]byte, 36)
+	v6[0], v6[1], v6[15] = 0x20, 0x01, 0x07
+	binary.BigEndian.PutUint16(v6[32:], 4242)
+
+	cases := []struct {
+		name   string
+		header []byte
+		remote string // "" keeps the peer address
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"), "192.0.2.1:56324"},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4242 443\r\n"), "[2001:db8::1]:4242"},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), ""},
+		{"v2 ipv4", v2Header(0x1, 0x1, v4), "192.0.2.1:56324"},
+		{"v2 ipv6", v2Header(0x1, 0x2, v6), "[2001::7]:4242"},
+		{"v2 local", v2Header(0x0, 0x0, nil), ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			remote, body, err := serve(t, append(tc.header, "GET / HTTP/1.1\r\n"...))
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if body != "GET / HTTP/1.1\r\n" {
+				t.Errorf("body = %q, want the bytes after the header", body)
+			}
+			if tc.remote != "" && remote != tc.remote {
+				t.Errorf("RemoteAddr = %s, want %s", remote, tc.remote)
+			}
+			if tc.remote == "" {
+				if host, _, _ := net.SplitHostPort(remote); host != "127.0.0.1" {
+					t.Errorf("RemoteAddr = %s, want the peer address", remote)
+				}
+			}
+		})
+	}
+}
+
+// TestListener_Invalid checks that connections without a valid header
+// fail to read.
+func TestListener_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"missing":   "GET / HTTP/1.1\r\n\r\n",
+		"bad v1":    "PROXY TCP4 not-an-ip 198.51.100.1 1 2\r\n",
+		"family":    "PROXY TCP4 2001:db8::1 198.51.100.1 1 2\r\n",
+		"too long":  "PROXY TCP4 " + string(make([]byte, 120)) + "\r\n",
+		"truncated": "PROXY TCP4 192.0.2.1",
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := serve(t, []byte(data))
+			if err == nil {
+				t.Fatal("read succeeded, want error")
+			}
+			if name == "missing" && !errors.Is(err, ErrNoHeader) {
+				t.Errorf("err = %v, want ErrNoHeader", err)
+			}
+		})
+	}
+}